@@ -270,11 +270,11 @@ WEBHOOK_WHITELIST_JIDS=
 
 ## First Run
 
-1. Start the application
-2. Check for `whatsapp-qrcode.png` file
+1. Start the application (the HTTP server starts right away)
+2. Open `http://localhost:8080/api/v1/session/qr` (with header `X-API-Key`) to get the QR code PNG
 3. Scan the QR code with WhatsApp: Settings > Linked Devices > Link a Device
-4. The application will connect and start the HTTP server
-5. Test with: `curl http://localhost:8080/health`
+   (or `POST /api/v1/session/pair-code` with `phone=628xxx` and enter the code on the phone)
+4. Check the link with: `curl http://localhost:8080/api/v1/session/status`
 
 ## Troubleshooting
 
@@ -337,12 +337,11 @@ WEBHOOK_WHITELIST_JIDS=
 
 ## First Run
 
-1. Start the application using any method above
-2. Look for `whatsapp-qrcode.png` in the application directory
+1. Start the application using any method above (the HTTP server starts right away)
+2. Open `http://<server>:8080/api/v1/session/qr` (with header `X-API-Key`) to get the QR code PNG
 3. Open WhatsApp on your phone: Settings → Linked Devices → Link a Device
-4. Scan the QR code
-5. The application will connect and start the HTTP server
-6. Test the connection: `curl http://localhost:8080/health`
+4. Scan the QR code (or `POST /api/v1/session/pair-code` with `phone=628xxx` and enter the code on the phone)
+5. Test the connection: `curl http://localhost:8080/api/v1/session/status`
 
 ## Troubleshooting
 
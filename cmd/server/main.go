@@ -15,7 +15,10 @@ import (
 
 	"whatsapp-h2h-otomax/internal/config"
 	"whatsapp-h2h-otomax/internal/handler"
+	"whatsapp-h2h-otomax/internal/metrics"
 	"whatsapp-h2h-otomax/internal/middleware"
+	"whatsapp-h2h-otomax/internal/model"
+	"whatsapp-h2h-otomax/internal/repository"
 	"whatsapp-h2h-otomax/internal/service"
 	"whatsapp-h2h-otomax/pkg/logger"
 )
@@ -36,8 +39,8 @@ func main() {
 	appLogger := logger.New(cfg.WhatsApp.LogLevel)
 	appLogger.Info("Starting WhatsApp H2H Otomax service")
 
-	// Initialize WhatsApp service
-	whatsappService, err := service.NewWhatsAppService(&cfg.WhatsApp, appLogger)
+	// Initialize WhatsApp session pool (one session per linked device)
+	whatsappService, err := service.NewSessionPool(&cfg.WhatsApp, appLogger)
 	if err != nil {
 		appLogger.Error("Failed to initialize WhatsApp service", "error", err)
 		log.Fatalf("Failed to initialize WhatsApp service: %v", err)
@@ -46,8 +49,12 @@ func main() {
 	// Initialize Otomax service
 	otomaxService := service.NewOtomaxService(&cfg.Otomax, appLogger)
 
+	// Initialize outbound send scheduler (rate limiting)
+	sendScheduler := service.NewSendScheduler(&cfg.RateLimit, appLogger)
+	defer sendScheduler.Stop()
+
 	// Initialize transaction service
-	transactionService, err := service.NewTransactionService(whatsappService, &cfg.MessageTracking, appLogger)
+	transactionService, err := service.NewTransactionService(whatsappService, sendScheduler, &cfg.MessageTracking, appLogger)
 	if err != nil {
 		appLogger.Error("Failed to initialize transaction service", "error", err)
 		log.Fatalf("Failed to initialize transaction service: %v", err)
@@ -58,38 +65,131 @@ func main() {
 	whatsappService.SetOtomaxService(otomaxService)
 	whatsappService.SetTransactionRepository(transactionService.GetRepository())
 	whatsappService.SetWebhookWhitelist(cfg.MessageTracking.WebhookWhitelist)
+	transactionService.SetOtomaxService(otomaxService)
 
-	// Connect to WhatsApp
-	err = whatsappService.Connect()
+	// Start webhook delivery workers (persistent outbox in tracking database)
+	webhookRepo, err := repository.NewWebhookRepository(transactionService.GetRepository().DB())
 	if err != nil {
-		appLogger.Error("Failed to connect to WhatsApp", "error", err)
-		log.Fatalf("Failed to connect to WhatsApp: %v\nPlease scan QR code first", err)
+		appLogger.Error("Failed to initialize webhook outbox", "error", err)
+		log.Fatalf("Failed to initialize webhook outbox: %v", err)
 	}
-	defer whatsappService.Disconnect()
+	otomaxService.Start(webhookRepo)
+	defer otomaxService.Stop()
+	transactionService.SetWebhookRepository(webhookRepo)
 
-	// Display joined groups
-	ctx := context.Background()
-	whatsappService.PrintJoinedGroups(ctx)
+	// Initialize media storage for media received from WhatsApp
+	mediaRepo, err := repository.NewMediaRepository(transactionService.GetRepository().DB())
+	if err != nil {
+		appLogger.Error("Failed to initialize media repository", "error", err)
+		log.Fatalf("Failed to initialize media repository: %v", err)
+	}
+	mediaService, err := service.NewMediaService(&cfg.Media, mediaRepo, appLogger)
+	if err != nil {
+		appLogger.Error("Failed to initialize media service", "error", err)
+		log.Fatalf("Failed to initialize media service: %v", err)
+	}
+	defer mediaService.Close()
+	whatsappService.SetMediaService(mediaService)
+	transactionService.SetMediaService(mediaService)
+
+	// Initialize message log (conversation of each transaction)
+	messageRepo, err := repository.NewMessageRepository(transactionService.GetRepository().DB())
+	if err != nil {
+		appLogger.Error("Failed to initialize message repository", "error", err)
+		log.Fatalf("Failed to initialize message repository: %v", err)
+	}
+	whatsappService.SetMessageRepository(messageRepo)
+	transactionService.SetMessageRepository(messageRepo)
+
+	// Load message templates
+	templateService, err := service.NewTemplateService(&cfg.Templates, appLogger)
+	if err != nil {
+		appLogger.Error("Failed to load message templates", "error", err)
+		log.Fatalf("Failed to load message templates: %v", err)
+	}
+	transactionService.SetTemplateService(templateService)
+
+	// Initialize API keys (SQLite key store or keys file, plus the legacy API_KEY)
+	apiKeyRepo, err := repository.NewAPIKeyRepository(transactionService.GetRepository().DB())
+	if err != nil {
+		appLogger.Error("Failed to initialize API key repository", "error", err)
+		log.Fatalf("Failed to initialize API key repository: %v", err)
+	}
+	apiKeyService, err := service.NewAPIKeyService(&cfg.Security, apiKeyRepo, appLogger)
+	if err != nil {
+		appLogger.Error("Failed to load API keys", "error", err)
+		log.Fatalf("Failed to load API keys: %v", err)
+	}
+	defer apiKeyService.Close()
+
+	// Start async outbound queue worker (drains on every WhatsApp connect)
+	transactionService.StartOutboundWorker(&cfg.OutboundQueue)
+
+	// Expose the active tracked transaction count on /metrics
+	metrics.RegisterTrackedTransactions(transactionService.GetRepository().Count)
 
 	// Initialize handlers
 	transactionHandler := handler.NewTransactionHandler(transactionService, appLogger)
 	webhookHandler := handler.NewWebhookHandler(cfg, appLogger)
-	healthHandler := handler.NewHealthHandler(whatsappService, cfg, appLogger)
+	healthHandler := handler.NewHealthHandler(whatsappService, transactionService.GetRepository(), otomaxService, cfg, appLogger)
 	groupsHandler := handler.NewGroupsHandler(whatsappService, appLogger)
+	deliveriesHandler := handler.NewDeliveriesHandler(otomaxService, appLogger)
+	mediaHandler := handler.NewMediaHandler(mediaService, appLogger)
+	templatesHandler := handler.NewTemplatesHandler(transactionService, templateService, appLogger)
+	sessionHandler := handler.NewSessionHandler(whatsappService, appLogger)
+	errorCodesHandler := handler.NewErrorCodesHandler(appLogger)
+	apiKeysHandler := handler.NewAPIKeysHandler(apiKeyService, appLogger)
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(cfg.Security.APIKey, appLogger)
+	authMiddleware := middleware.NewAuthMiddleware(apiKeyService, appLogger)
+	if err := authMiddleware.SetForwardAllowlist(cfg.Security.ForwardAllowedIPs, cfg.Security.TrustedProxies); err != nil {
+		appLogger.Error("Failed to configure forward allowlist", "error", err)
+		log.Fatalf("Failed to configure forward allowlist: %v", err)
+	}
+	// Signed bodies are read whole before the handler, allow the largest forward body (media upload or batch)
+	maxSignedBody := max(int64(cfg.Media.MaxSizeMB+1)<<20, handler.MaxBatchBody)
+	authMiddleware.SetForwardSigning(cfg.Security.SigningSecret, cfg.Security.SignatureTolerance, maxSignedBody)
 
 	// Setup HTTP routes
 	mux := http.NewServeMux()
 
 	// Public routes
-	mux.HandleFunc("/health", healthHandler.CheckHealth)
-
-	// Protected routes
-	mux.HandleFunc("/api/v1/forward", authMiddleware.Authenticate(transactionHandler.ForwardTransaction))
-	mux.HandleFunc("/api/v1/webhook/message", authMiddleware.Authenticate(webhookHandler.ReceiveMessage))
-	mux.HandleFunc("/api/v1/groups", authMiddleware.Authenticate(groupsHandler.ListGroups))
+	mux.HandleFunc("/health", healthHandler.Ready)
+	mux.HandleFunc("GET /health/live", healthHandler.Live)
+	mux.HandleFunc("GET /health/ready", healthHandler.Ready)
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	// Protected routes (each route requires a scope of the API key).
+	// Forward routes check the API key before RestrictForward buffers a signed body.
+	mux.HandleFunc("/api/v1/forward", authMiddleware.RequireScope(model.ScopeForward, authMiddleware.RestrictForward(transactionHandler.ForwardTransaction)))
+	mux.HandleFunc("POST /api/v1/forward", authMiddleware.RequireScope(model.ScopeForward, authMiddleware.RestrictForward(transactionHandler.ForwardTransactionWithMedia)))
+	mux.HandleFunc("POST /api/v1/forward/batch", authMiddleware.RequireScope(model.ScopeForward, authMiddleware.RestrictForward(transactionHandler.ForwardBatch)))
+	mux.HandleFunc("/api/v1/webhook/message", authMiddleware.RequireScope(model.ScopeAdmin, webhookHandler.ReceiveMessage))
+	mux.HandleFunc("/api/v1/groups", authMiddleware.RequireScope(model.ScopeGroups, groupsHandler.ListGroups))
+	mux.HandleFunc("GET /api/v1/transactions/{trxid}", authMiddleware.RequireScope(model.ScopeForward, transactionHandler.GetTransaction))
+	mux.HandleFunc("GET /api/v1/transactions/{trxid}/messages", authMiddleware.RequireScope(model.ScopeForward, transactionHandler.GetTransactionMessages))
+	mux.HandleFunc("GET /api/v1/media/{id}", authMiddleware.RequireScope(model.ScopeForward, mediaHandler.GetMedia))
+	mux.HandleFunc("GET /api/v1/templates/render", authMiddleware.RequireScope(model.ScopeForward, templatesHandler.RenderTemplate))
+	mux.HandleFunc("POST /api/v1/templates/reload", authMiddleware.RequireScope(model.ScopeAdmin, templatesHandler.ReloadTemplates))
+	mux.HandleFunc("GET /api/v1/errors", authMiddleware.Authenticate(errorCodesHandler.ListErrorCodes))
+
+	// Webhook delivery admin routes
+	mux.HandleFunc("GET /api/v1/webhooks/deliveries", authMiddleware.RequireScope(model.ScopeAdmin, deliveriesHandler.ListDeliveries))
+	mux.HandleFunc("GET /api/v1/webhooks/deliveries/{id}", authMiddleware.RequireScope(model.ScopeAdmin, deliveriesHandler.GetDelivery))
+	mux.HandleFunc("POST /api/v1/webhooks/deliveries/{id}/replay", authMiddleware.RequireScope(model.ScopeAdmin, deliveriesHandler.ReplayDelivery))
+	mux.HandleFunc("POST /api/v1/webhooks/deliveries/replay", authMiddleware.RequireScope(model.ScopeAdmin, deliveriesHandler.ReplayDeadDeliveries))
+
+	// WhatsApp session (remote login) routes
+	mux.HandleFunc("GET /api/v1/session/status", authMiddleware.RequireScope(model.ScopeAdmin, sessionHandler.GetStatus))
+	mux.HandleFunc("GET /api/v1/session/qr", authMiddleware.RequireScope(model.ScopeAdmin, sessionHandler.GetQR))
+	mux.HandleFunc("POST /api/v1/session/pair-code", authMiddleware.RequireScope(model.ScopeAdmin, sessionHandler.RequestPairCode))
+	mux.HandleFunc("POST /api/v1/session/logout", authMiddleware.RequireScope(model.ScopeAdmin, sessionHandler.Logout))
+
+	// API key management routes
+	mux.HandleFunc("GET /api/v1/keys", authMiddleware.RequireScope(model.ScopeAdmin, apiKeysHandler.ListKeys))
+	mux.HandleFunc("POST /api/v1/keys", authMiddleware.RequireScope(model.ScopeAdmin, apiKeysHandler.CreateKey))
+	mux.HandleFunc("POST /api/v1/keys/{name}/rotate", authMiddleware.RequireScope(model.ScopeAdmin, apiKeysHandler.RotateKey))
+	mux.HandleFunc("DELETE /api/v1/keys/{name}", authMiddleware.RequireScope(model.ScopeAdmin, apiKeysHandler.RevokeKey))
 
 	// Create HTTP server
 	addr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
@@ -101,7 +201,7 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	// Start server in goroutine
+	// Start server in goroutine (before connecting, so unpaired devices can be linked through the API)
 	go func() {
 		appLogger.Info("HTTP server starting", "address", addr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -110,6 +210,17 @@ func main() {
 		}
 	}()
 
+	// Connect to WhatsApp (unpaired devices wait for pairing in the background)
+	err = whatsappService.Connect()
+	if err != nil {
+		appLogger.Error("Failed to connect to WhatsApp", "error", err)
+		log.Fatalf("Failed to connect to WhatsApp: %v", err)
+	}
+	defer whatsappService.Disconnect()
+
+	// Display joined groups
+	whatsappService.PrintJoinedGroups(context.Background())
+
 	appLogger.Info("WhatsApp H2H Otomax service started successfully",
 		"address", addr,
 		"whatsapp_connected", whatsappService.IsConnected(),
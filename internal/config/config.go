@@ -18,6 +18,9 @@ type Config struct {
 	Security        SecurityConfig
 	RateLimit       RateLimitConfig
 	MessageTracking MessageTrackingConfig
+	OutboundQueue   OutboundQueueConfig
+	Media           MediaConfig
+	Templates       TemplateConfig
 }
 
 // ServerConfig holds server configuration
@@ -28,8 +31,15 @@ type ServerConfig struct {
 
 // WhatsAppConfig holds WhatsApp configuration
 type WhatsAppConfig struct {
-	DBPath   string
-	LogLevel string
+	DBPath        string
+	LogLevel      string
+	AddDevice     bool
+	DefaultSender string
+	SenderRoutes  []string
+
+	// Reconnect backoff after the connection to WhatsApp is lost
+	ReconnectBackoffBase time.Duration
+	ReconnectBackoffMax  time.Duration
 }
 
 // OtomaxConfig holds Otomax webhook configuration
@@ -37,23 +47,63 @@ type OtomaxConfig struct {
 	WebhookURL     string
 	WebhookTimeout time.Duration
 	RetryCount     int
+	Workers        int
+	BackoffBase    time.Duration
+	BackoffMax     time.Duration
+	AlertURL       string // Receives session_status alerts instead of WebhookURL if set
+	WebhookSecret  string // Shared secret for the X-Signature HMAC, unsigned if empty
 }
 
 // SecurityConfig holds security configuration
 type SecurityConfig struct {
-	APIKey string
+	APIKey         string        // Legacy single key, accepted as key "default" with all scopes
+	KeyStore       string        // Where named API keys are kept: "sqlite" or "file"
+	KeysFile       string        // JSON file with the API keys of the file store
+	KeyGracePeriod time.Duration // How long an expired or rotated key keeps working
+
+	// Restrictions of the forward API, on top of the API key
+	ForwardAllowedIPs  []string      // IPs or CIDRs allowed to forward transactions, any if empty
+	TrustedProxies     []string      // IPs or CIDRs of proxies whose X-Forwarded-For is trusted
+	SigningSecret      string        // Shared secret of signed forward requests, unsigned if empty
+	SignatureTolerance time.Duration // Maximum age (and clock skew) of a signed request
 }
 
 // RateLimitConfig holds rate limiting configuration
 type RateLimitConfig struct {
-	MaxMessagesPerSecond int
+	MaxMessagesPerSecond   int
+	PerDestinationInterval time.Duration
+	SendQueueSize          int
 }
 
 // MessageTrackingConfig holds message tracking configuration
 type MessageTrackingConfig struct {
-	TTL              time.Duration
-	TrackingDBPath   string
-	WebhookWhitelist []string
+	TTL               time.Duration
+	Retention         time.Duration // How long expired transactions are kept, 0 keeps them forever
+	TrackingDBPath    string
+	WebhookWhitelist  []string
+	IdempotentForward bool // Replay the original result for retries of a TrxID with the same content
+}
+
+// OutboundQueueConfig holds async outbound queue configuration
+type OutboundQueueConfig struct {
+	MaxAttempts   int
+	RetryInterval time.Duration
+}
+
+// MediaConfig holds configuration for media received from WhatsApp
+type MediaConfig struct {
+	StoragePath   string
+	Retention     time.Duration
+	MaxSizeMB     int
+	PublicBaseURL string
+
+	// Private networks media_url may point to, only public addresses are fetched otherwise
+	FetchAllowedNetworks []string
+}
+
+// TemplateConfig holds message template configuration
+type TemplateConfig struct {
+	Path string
 }
 
 // Load loads configuration from environment variables
@@ -67,24 +117,62 @@ func Load() (*Config, error) {
 			Host: getEnv("HOST", "0.0.0.0"),
 		},
 		WhatsApp: WhatsAppConfig{
-			DBPath:   getEnv("WA_DB_PATH", "./db/whatsmeow.db"),
-			LogLevel: getEnv("WA_LOG_LEVEL", "INFO"),
+			DBPath:        getEnv("WA_DB_PATH", "./db/whatsmeow.db"),
+			LogLevel:      getEnv("WA_LOG_LEVEL", "INFO"),
+			AddDevice:     parseBool(getEnv("WA_ADD_DEVICE", "false"), false),
+			DefaultSender: getEnv("WA_DEFAULT_SENDER", ""),
+			SenderRoutes:  parseStringList(getEnv("WA_SENDER_ROUTES", "")),
+
+			ReconnectBackoffBase: parseDuration(getEnv("WA_RECONNECT_BACKOFF_BASE", "2s"), 2*time.Second),
+			ReconnectBackoffMax:  parseDuration(getEnv("WA_RECONNECT_BACKOFF_MAX", "5m"), 5*time.Minute),
 		},
 		Otomax: OtomaxConfig{
 			WebhookURL:     getEnv("OTOMAX_WEBHOOK_URL", ""),
 			WebhookTimeout: parseDuration(getEnv("OTOMAX_WEBHOOK_TIMEOUT", "10s"), 10*time.Second),
 			RetryCount:     parseInt(getEnv("OTOMAX_WEBHOOK_RETRY_COUNT", "3"), 3),
+			Workers:        parseInt(getEnv("OTOMAX_WEBHOOK_WORKERS", "2"), 2),
+			BackoffBase:    parseDuration(getEnv("OTOMAX_WEBHOOK_BACKOFF_BASE", "2s"), 2*time.Second),
+			BackoffMax:     parseDuration(getEnv("OTOMAX_WEBHOOK_BACKOFF_MAX", "10m"), 10*time.Minute),
+			AlertURL:       getEnv("ALERT_WEBHOOK_URL", ""),
+			WebhookSecret:  getEnv("OTOMAX_WEBHOOK_SECRET", ""),
 		},
 		Security: SecurityConfig{
-			APIKey: getEnv("API_KEY", ""),
+			APIKey:         getEnv("API_KEY", ""),
+			KeyStore:       strings.ToLower(getEnv("API_KEY_STORE", "sqlite")),
+			KeysFile:       getEnv("API_KEYS_FILE", "./api_keys.json"),
+			KeyGracePeriod: parseDuration(getEnv("API_KEY_GRACE_PERIOD", "24h"), 24*time.Hour),
+
+			ForwardAllowedIPs:  parseStringList(getEnv("FORWARD_ALLOWED_IPS", "")),
+			TrustedProxies:     parseStringList(getEnv("TRUSTED_PROXIES", "")),
+			SigningSecret:      getEnv("FORWARD_SIGNING_SECRET", ""),
+			SignatureTolerance: parseDuration(getEnv("FORWARD_SIGNATURE_TOLERANCE", "5m"), 5*time.Minute),
 		},
 		RateLimit: RateLimitConfig{
-			MaxMessagesPerSecond: parseInt(getEnv("MAX_MESSAGES_PER_SECOND", "5"), 5),
+			MaxMessagesPerSecond:   parseInt(getEnv("MAX_MESSAGES_PER_SECOND", "5"), 5),
+			PerDestinationInterval: parseDuration(getEnv("PER_DESTINATION_INTERVAL", "1s"), time.Second),
+			SendQueueSize:          parseInt(getEnv("SEND_QUEUE_SIZE", "100"), 100),
 		},
 		MessageTracking: MessageTrackingConfig{
-			TTL:              parseDuration(getEnv("MESSAGE_TRACKING_TTL", "24h"), 24*time.Hour),
-			TrackingDBPath:   getEnv("TRACKING_DB_PATH", "./db/tracking.db"),
-			WebhookWhitelist: parseStringList(getEnv("WEBHOOK_WHITELIST_JIDS", "")),
+			TTL:               parseDuration(getEnv("MESSAGE_TRACKING_TTL", "24h"), 24*time.Hour),
+			Retention:         parseDuration(getEnv("TRANSACTION_RETENTION", "720h"), 720*time.Hour),
+			TrackingDBPath:    getEnv("TRACKING_DB_PATH", "./db/tracking.db"),
+			WebhookWhitelist:  parseStringList(getEnv("WEBHOOK_WHITELIST_JIDS", "")),
+			IdempotentForward: parseBool(getEnv("FORWARD_IDEMPOTENCY", "false"), false),
+		},
+		OutboundQueue: OutboundQueueConfig{
+			MaxAttempts:   parseInt(getEnv("OUTBOUND_MAX_ATTEMPTS", "5"), 5),
+			RetryInterval: parseDuration(getEnv("OUTBOUND_RETRY_INTERVAL", "30s"), 30*time.Second),
+		},
+		Media: MediaConfig{
+			StoragePath:   getEnv("MEDIA_STORAGE_PATH", "./media"),
+			Retention:     parseDuration(getEnv("MEDIA_RETENTION", "168h"), 168*time.Hour),
+			MaxSizeMB:     parseInt(getEnv("MEDIA_MAX_SIZE_MB", "25"), 25),
+			PublicBaseURL: strings.TrimRight(getEnv("PUBLIC_BASE_URL", ""), "/"),
+
+			FetchAllowedNetworks: parseStringList(getEnv("MEDIA_FETCH_ALLOWED_NETWORKS", "")),
+		},
+		Templates: TemplateConfig{
+			Path: getEnv("MESSAGE_TEMPLATES_PATH", "./templates.json"),
 		},
 	}
 
@@ -92,6 +180,18 @@ func Load() (*Config, error) {
 	if config.Otomax.WebhookURL == "" {
 		return nil, fmt.Errorf("OTOMAX_WEBHOOK_URL is required")
 	}
+	if config.Security.KeyStore != "sqlite" && config.Security.KeyStore != "file" {
+		return nil, fmt.Errorf("API_KEY_STORE must be sqlite or file, got %q", config.Security.KeyStore)
+	}
+	if config.Otomax.Workers < 1 {
+		return nil, fmt.Errorf("OTOMAX_WEBHOOK_WORKERS must be at least 1, got %d", config.Otomax.Workers)
+	}
+	if config.OutboundQueue.MaxAttempts < 1 {
+		return nil, fmt.Errorf("OUTBOUND_MAX_ATTEMPTS must be at least 1, got %d", config.OutboundQueue.MaxAttempts)
+	}
+	if config.OutboundQueue.RetryInterval <= 0 {
+		return nil, fmt.Errorf("OUTBOUND_RETRY_INTERVAL must be positive, got %s", config.OutboundQueue.RetryInterval)
+	}
 
 	return config, nil
 }
@@ -117,6 +217,18 @@ func parseInt(value string, defaultValue int) int {
 	return intValue
 }
 
+// parseBool parses string to bool with default value
+func parseBool(value string, defaultValue bool) bool {
+	if value == "" {
+		return defaultValue
+	}
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue
+	}
+	return boolValue
+}
+
 // parseDuration parses string to time.Duration with default value
 func parseDuration(value string, defaultValue time.Duration) time.Duration {
 	if value == "" {
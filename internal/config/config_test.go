@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestLoadValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"defaults", nil, false},
+		{"missing webhook URL", map[string]string{"OTOMAX_WEBHOOK_URL": ""}, true},
+		{"unknown key store", map[string]string{"API_KEY_STORE": "redis"}, true},
+		{"webhook workers zero", map[string]string{"OTOMAX_WEBHOOK_WORKERS": "0"}, true},
+		{"outbound max attempts zero", map[string]string{"OUTBOUND_MAX_ATTEMPTS": "0"}, true},
+		{"outbound max attempts negative", map[string]string{"OUTBOUND_MAX_ATTEMPTS": "-1"}, true},
+		{"outbound retry interval zero", map[string]string{"OUTBOUND_RETRY_INTERVAL": "0s"}, true},
+		{"outbound retry interval negative", map[string]string{"OUTBOUND_RETRY_INTERVAL": "-5s"}, true},
+		{"outbound retry interval set", map[string]string{"OUTBOUND_RETRY_INTERVAL": "5s", "OUTBOUND_MAX_ATTEMPTS": "1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTOMAX_WEBHOOK_URL", "https://otomax.example.com/webhook")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			_, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"whatsapp-h2h-otomax/internal/middleware"
+	"whatsapp-h2h-otomax/internal/model"
+	"whatsapp-h2h-otomax/internal/service"
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+// APIKeysHandler handles management of the API keys of the SQLite key store
+type APIKeysHandler struct {
+	keys   *service.APIKeyService
+	logger *logger.Logger
+}
+
+// NewAPIKeysHandler creates a new API keys handler
+func NewAPIKeysHandler(keys *service.APIKeyService, log *logger.Logger) *APIKeysHandler {
+	return &APIKeysHandler{
+		keys:   keys,
+		logger: log,
+	}
+}
+
+// CreateAPIKeyRequest represents the body of POST /api/v1/keys
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeysResponse represents the API response
+type APIKeysResponse struct {
+	Status  string                  `json:"status"`
+	Message string                  `json:"message"`
+	Data    interface{}             `json:"data,omitempty"`
+	Error   *model.TransactionError `json:"error,omitempty"`
+}
+
+// ListKeys handles GET /api/v1/keys
+func (h *APIKeysHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	h.sendResponse(w, "API keys retrieved successfully", h.keys.List(), http.StatusOK)
+}
+
+// CreateKey handles POST /api/v1/keys
+// The secret of the new key is only returned in this response.
+func (h *APIKeysHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, "ERR_INVALID_PARAMETER", "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret, err := h.keys.Create(req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		h.sendServiceError(w, r, "Failed to create API key", err)
+		return
+	}
+
+	requestLogger(h.logger, r).Info("API key created remotely", "name", req.Name, "remote_addr", r.RemoteAddr)
+	h.sendResponse(w, "API key created, store the key now, it can't be retrieved again", secret, http.StatusCreated)
+}
+
+// RotateKey handles POST /api/v1/keys/{name}/rotate
+// The previous secret keeps working for API_KEY_GRACE_PERIOD.
+func (h *APIKeysHandler) RotateKey(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	secret, err := h.keys.Rotate(name)
+	if err != nil {
+		h.sendServiceError(w, r, "Failed to rotate API key", err)
+		return
+	}
+
+	requestLogger(h.logger, r).Info("API key rotated remotely", "name", name, "remote_addr", r.RemoteAddr)
+	h.sendResponse(w, "API key rotated, the previous key works until previous_expires_at", secret, http.StatusOK)
+}
+
+// RevokeKey handles DELETE /api/v1/keys/{name}
+func (h *APIKeysHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if err := h.keys.Revoke(name); err != nil {
+		h.sendServiceError(w, r, "Failed to revoke API key", err)
+		return
+	}
+
+	requestLogger(h.logger, r).Warn("API key revoked remotely", "name", name, "remote_addr", r.RemoteAddr)
+	h.sendResponse(w, "API key revoked", nil, http.StatusOK)
+}
+
+// sendServiceError maps a key management error to its error code and sends it
+func (h *APIKeysHandler) sendServiceError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	code, statusCode := mapServiceError(err)
+	if statusCode >= http.StatusInternalServerError {
+		requestLogger(h.logger, r).Error(message, "error", err)
+	}
+	h.sendError(w, code, err.Error(), statusCode)
+}
+
+// sendResponse sends a success response
+func (h *APIKeysHandler) sendResponse(w http.ResponseWriter, message string, data interface{}, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+
+	json.NewEncoder(w).Encode(APIKeysResponse{
+		Status:  "success",
+		Message: message,
+		Data:    data,
+	})
+}
+
+// sendError sends an error response
+func (h *APIKeysHandler) sendError(w http.ResponseWriter, code, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	json.NewEncoder(w).Encode(APIKeysResponse{
+		Status:  "error",
+		Message: message,
+		Error: &model.TransactionError{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+// requestLogger returns the logger tagged with the name of the API key that made the request
+func requestLogger(log *logger.Logger, r *http.Request) *logger.Logger {
+	if key := middleware.APIKeyFromContext(r.Context()); key != nil {
+		return log.WithAPIKey(key.Name)
+	}
+	return log
+}
+
+// apiKeyName returns the name of the API key that made the request
+func apiKeyName(r *http.Request) string {
+	if key := middleware.APIKeyFromContext(r.Context()); key != nil {
+		return key.Name
+	}
+	return ""
+}
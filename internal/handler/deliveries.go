@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"whatsapp-h2h-otomax/internal/repository"
+	"whatsapp-h2h-otomax/internal/service"
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+// DeliveriesHandler handles inspection and replay of Otomax webhook deliveries
+type DeliveriesHandler struct {
+	otomaxService *service.OtomaxService
+	logger        *logger.Logger
+}
+
+// NewDeliveriesHandler creates a new webhook deliveries handler
+func NewDeliveriesHandler(otomaxService *service.OtomaxService, log *logger.Logger) *DeliveriesHandler {
+	return &DeliveriesHandler{
+		otomaxService: otomaxService,
+		logger:        log,
+	}
+}
+
+// DeliveryInfo represents a webhook delivery for API response
+type DeliveryInfo struct {
+	*repository.WebhookDelivery
+	Payload  json.RawMessage              `json:"payload"`
+	Attempts []*repository.WebhookAttempt `json:"attempt_history,omitempty"`
+}
+
+// DeliveriesResponse represents the API response
+type DeliveriesResponse struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// ListDeliveries handles GET /api/v1/webhooks/deliveries
+func (h *DeliveriesHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := repository.WebhookFilter{
+		Status: query.Get("status"),
+		TrxID:  query.Get("trxid"),
+		Event:  query.Get("event"),
+		Limit:  parseQueryInt(query.Get("limit"), 50),
+		Offset: parseQueryInt(query.Get("offset"), 0),
+	}
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	deliveries, err := h.otomaxService.ListDeliveries(filter)
+	if err != nil {
+		requestLogger(h.logger, r).Error("Failed to list webhook deliveries", "error", err)
+		h.sendResponse(w, "error", "Failed to retrieve webhook deliveries", nil, http.StatusInternalServerError)
+		return
+	}
+
+	list := make([]DeliveryInfo, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		list = append(list, newDeliveryInfo(delivery, nil))
+	}
+
+	h.sendResponse(w, "success", "Webhook deliveries retrieved successfully", list, http.StatusOK)
+}
+
+// GetDelivery handles GET /api/v1/webhooks/deliveries/{id}
+func (h *DeliveriesHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.sendResponse(w, "error", "Invalid delivery ID", nil, http.StatusBadRequest)
+		return
+	}
+
+	delivery, attempts, err := h.otomaxService.GetDelivery(id)
+	if err != nil {
+		requestLogger(h.logger, r).Error("Failed to get webhook delivery", "error", err, "delivery_id", id)
+		h.sendResponse(w, "error", "Failed to retrieve webhook delivery", nil, http.StatusInternalServerError)
+		return
+	}
+	if delivery == nil {
+		h.sendResponse(w, "error", "Webhook delivery not found", nil, http.StatusNotFound)
+		return
+	}
+
+	h.sendResponse(w, "success", "Webhook delivery retrieved successfully", newDeliveryInfo(delivery, attempts), http.StatusOK)
+}
+
+// ReplayDelivery handles POST /api/v1/webhooks/deliveries/{id}/replay
+func (h *DeliveriesHandler) ReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		h.sendResponse(w, "error", "Invalid delivery ID", nil, http.StatusBadRequest)
+		return
+	}
+
+	replayed, err := h.otomaxService.ReplayDelivery(id)
+	if err != nil {
+		requestLogger(h.logger, r).Error("Failed to replay webhook delivery", "error", err, "delivery_id", id)
+		h.sendResponse(w, "error", "Failed to replay webhook delivery", nil, http.StatusInternalServerError)
+		return
+	}
+	if !replayed {
+		h.sendResponse(w, "error", "Webhook delivery not found or currently being sent", nil, http.StatusConflict)
+		return
+	}
+
+	requestLogger(h.logger, r).Info("Webhook delivery replayed manually",
+		"delivery_id", id,
+		"remote_addr", r.RemoteAddr,
+	)
+	h.sendResponse(w, "success", "Webhook delivery scheduled for replay", map[string]interface{}{"id": id}, http.StatusAccepted)
+}
+
+// ReplayDeadDeliveries handles POST /api/v1/webhooks/deliveries/replay
+// Replays all dead-lettered deliveries, optionally only those of ?trxid=
+func (h *DeliveriesHandler) ReplayDeadDeliveries(w http.ResponseWriter, r *http.Request) {
+	trxID := r.URL.Query().Get("trxid")
+
+	count, err := h.otomaxService.ReplayDeadDeliveries(trxID)
+	if err != nil {
+		requestLogger(h.logger, r).Error("Failed to replay dead webhook deliveries", "error", err)
+		h.sendResponse(w, "error", "Failed to replay webhook deliveries", nil, http.StatusInternalServerError)
+		return
+	}
+
+	requestLogger(h.logger, r).Info("Dead-lettered webhook deliveries replayed manually",
+		"count", count,
+		"trxid", trxID,
+		"remote_addr", r.RemoteAddr,
+	)
+	h.sendResponse(w, "success", "Dead-lettered webhook deliveries scheduled for replay", map[string]interface{}{"replayed": count}, http.StatusAccepted)
+}
+
+// sendResponse sends JSON response
+func (h *DeliveriesHandler) sendResponse(w http.ResponseWriter, status, message string, data interface{}, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	response := DeliveriesResponse{
+		Status:  status,
+		Message: message,
+		Data:    data,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// newDeliveryInfo converts a delivery record to its API representation
+func newDeliveryInfo(delivery *repository.WebhookDelivery, attempts []*repository.WebhookAttempt) DeliveryInfo {
+	return DeliveryInfo{
+		WebhookDelivery: delivery,
+		Payload:         json.RawMessage(delivery.Payload),
+		Attempts:        attempts,
+	}
+}
+
+// parseQueryInt parses query parameter to int with default value
+func parseQueryInt(value string, defaultValue int) int {
+	if value == "" {
+		return defaultValue
+	}
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue
+	}
+	return intValue
+}
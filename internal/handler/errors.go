@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"whatsapp-h2h-otomax/internal/service"
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+// ErrorCode describes an error code returned by the API
+type ErrorCode struct {
+	Code        string `json:"code"`
+	HTTPStatus  int    `json:"http_status"`
+	Description string `json:"description"`
+}
+
+// errorCodes is the catalog of all error codes returned by the API
+var errorCodes = []ErrorCode{
+	{"ERR_MISSING_PARAMETER", http.StatusBadRequest, "Required parameter missing"},
+	{"ERR_INVALID_PARAMETER", http.StatusBadRequest, "Invalid parameter value or form data"},
+	{"ERR_INVALID_DESTINATION", http.StatusBadRequest, "Invalid WhatsApp number/group JID format"},
+	{"ERR_INVALID_SENDER", http.StatusBadRequest, "Sender (or the sender of a routing rule) is not a linked device"},
+	{"ERR_INVALID_MEDIA", http.StatusBadRequest, "Invalid, empty or not allowed media attachment (413 if too large)"},
+	{"ERR_UNAUTHORIZED", http.StatusUnauthorized, "Invalid, expired or missing API key"},
+	{"ERR_INVALID_SIGNATURE", http.StatusUnauthorized, "Missing, expired, replayed or invalid request signature"},
+	{"ERR_FORBIDDEN", http.StatusForbidden, "API key lacks the scope required by the endpoint, or IP address not allowed"},
+	{"ERR_API_KEY_NOT_FOUND", http.StatusNotFound, "API key not found in the key store"},
+	{"ERR_API_KEY_EXISTS", http.StatusConflict, "API key name already taken"},
+	{"ERR_KEY_STORE_READ_ONLY", http.StatusConflict, "API keys are managed in API_KEYS_FILE, not through the API"},
+	{"ERR_GROUP_NOT_FOUND", http.StatusNotFound, "Group not found or bot not a member"},
+	{"ERR_DESTINATION_NOT_ON_WHATSAPP", http.StatusNotFound, "Phone number not registered on WhatsApp"},
+	{"ERR_TRANSACTION_NOT_FOUND", http.StatusNotFound, "Transaction not found"},
+	{"ERR_DUPLICATE_TRANSACTION", http.StatusConflict, "TrxID is still tracked or queued with a different destination or content"},
+	{"ERR_TEMPLATE_RENDER_FAILED", http.StatusUnprocessableEntity, "Message template failed to render"},
+	{"ERR_RATE_LIMIT_EXCEEDED", http.StatusTooManyRequests, "Send queue is full, rate limit exceeded"},
+	{"ERR_INTERNAL_SERVER", http.StatusInternalServerError, "Internal server error"},
+	{"ERR_MESSAGE_SEND_FAILED", http.StatusBadGateway, "WhatsApp did not accept the message"},
+	{"ERR_MEDIA_FETCH_FAILED", http.StatusBadGateway, "Failed to download media_url"},
+	{"ERR_WHATSAPP_NOT_CONNECTED", http.StatusServiceUnavailable, "WhatsApp client not connected or no linked device"},
+}
+
+// serviceErrors maps service errors to error codes. Errors may wrap several of them
+// (e.g. a send failure caused by a lost connection), so the most specific comes first.
+var serviceErrors = []struct {
+	err  error
+	code string
+}{
+	{service.ErrDuplicateTransaction, "ERR_DUPLICATE_TRANSACTION"},
+	{service.ErrSendQueueFull, "ERR_RATE_LIMIT_EXCEEDED"},
+	{service.ErrNotConnected, "ERR_WHATSAPP_NOT_CONNECTED"},
+	{service.ErrInvalidSender, "ERR_INVALID_SENDER"},
+	{service.ErrInvalidDestination, "ERR_INVALID_DESTINATION"},
+	{service.ErrGroupNotFound, "ERR_GROUP_NOT_FOUND"},
+	{service.ErrNotOnWhatsApp, "ERR_DESTINATION_NOT_ON_WHATSAPP"},
+	{service.ErrInvalidTemplate, "ERR_TEMPLATE_RENDER_FAILED"},
+	{service.ErrInvalidMedia, "ERR_INVALID_MEDIA"},
+	{service.ErrMediaFetchFailed, "ERR_MEDIA_FETCH_FAILED"},
+	{service.ErrSendFailed, "ERR_MESSAGE_SEND_FAILED"},
+	{service.ErrInvalidAPIKey, "ERR_INVALID_PARAMETER"},
+	{service.ErrAPIKeyExists, "ERR_API_KEY_EXISTS"},
+	{service.ErrAPIKeyNotFound, "ERR_API_KEY_NOT_FOUND"},
+	{service.ErrKeyStoreReadOnly, "ERR_KEY_STORE_READ_ONLY"},
+}
+
+// mapServiceError maps an error returned by the service to its error code and HTTP status
+func mapServiceError(err error) (string, int) {
+	for _, mapping := range serviceErrors {
+		if errors.Is(err, mapping.err) {
+			return mapping.code, errorStatus(mapping.code)
+		}
+	}
+	return "ERR_INTERNAL_SERVER", http.StatusInternalServerError
+}
+
+// errorStatus returns the HTTP status of an error code from the catalog
+func errorStatus(code string) int {
+	for _, errorCode := range errorCodes {
+		if errorCode.Code == code {
+			return errorCode.HTTPStatus
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorCodesResponse represents the API response
+type ErrorCodesResponse struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Data    []ErrorCode `json:"data"`
+}
+
+// ErrorCodesHandler serves the error code catalog
+type ErrorCodesHandler struct {
+	logger *logger.Logger
+}
+
+// NewErrorCodesHandler creates a new error codes handler
+func NewErrorCodesHandler(log *logger.Logger) *ErrorCodesHandler {
+	return &ErrorCodesHandler{
+		logger: log,
+	}
+}
+
+// ListErrorCodes handles GET /api/v1/errors
+func (h *ErrorCodesHandler) ListErrorCodes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := ErrorCodesResponse{
+		Status:  "success",
+		Message: "Error codes retrieved successfully",
+		Data:    errorCodes,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
@@ -10,12 +10,12 @@ import (
 
 // GroupsHandler handles group-related requests
 type GroupsHandler struct {
-	whatsappService *service.WhatsAppService
+	whatsappService *service.SessionPool
 	logger          *logger.Logger
 }
 
 // NewGroupsHandler creates a new groups handler
-func NewGroupsHandler(waService *service.WhatsAppService, log *logger.Logger) *GroupsHandler {
+func NewGroupsHandler(waService *service.SessionPool, log *logger.Logger) *GroupsHandler {
 	return &GroupsHandler{
 		whatsappService: waService,
 		logger:          log,
@@ -25,6 +25,7 @@ func NewGroupsHandler(waService *service.WhatsAppService, log *logger.Logger) *G
 // GroupInfo represents group information for API response
 type GroupInfo struct {
 	JID          string `json:"jid"`
+	Sender       string `json:"sender"` // WhatsApp number (device) that is a member of the group
 	Name         string `json:"name"`
 	Topic        string `json:"topic,omitempty"`
 	Participants int    `json:"participants"`
@@ -39,36 +40,54 @@ type GetGroupsResponse struct {
 }
 
 // ListGroups handles GET /api/v1/groups
+// Lists the groups of all connected devices, or of one device with ?sender=
 func (h *GroupsHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	groups, err := h.whatsappService.GetJoinedGroups(ctx)
-	if err != nil {
-		h.logger.Error("Failed to get joined groups", "error", err)
-		h.sendErrorResponse(w, "Failed to retrieve groups", http.StatusInternalServerError)
-		return
+	sessions := h.whatsappService.Sessions()
+	if sender := r.URL.Query().Get("sender"); sender != "" {
+		session := h.whatsappService.Get(sender)
+		if session == nil {
+			h.sendErrorResponse(w, "Sender is not a linked device", http.StatusNotFound)
+			return
+		}
+		sessions = []*service.WhatsAppService{session}
 	}
 
 	// Convert to API response format
-	groupsList := make([]GroupInfo, 0, len(groups))
-	for _, group := range groups {
-		groupInfo := GroupInfo{
-			JID:          group.JID.String(),
-			Name:         group.Name,
-			Participants: len(group.Participants),
+	groupsList := make([]GroupInfo, 0)
+	for _, session := range sessions {
+		if session.ID() == "" || (len(sessions) > 1 && !session.IsConnected()) {
+			continue
 		}
 
-		// Get additional info
-		info, err := h.whatsappService.GetClient().GetGroupInfo(group.JID)
-		if err == nil {
-			groupInfo.Topic = info.Topic
-			groupInfo.IsAnnounce = info.IsAnnounce
+		groups, err := session.GetJoinedGroups(ctx)
+		if err != nil {
+			requestLogger(h.logger, r).Error("Failed to get joined groups", "error", err, "sender", session.ID())
+			h.sendErrorResponse(w, "Failed to retrieve groups", http.StatusInternalServerError)
+			return
 		}
 
-		groupsList = append(groupsList, groupInfo)
+		for _, group := range groups {
+			groupInfo := GroupInfo{
+				JID:          group.JID.String(),
+				Sender:       session.ID(),
+				Name:         group.Name,
+				Participants: len(group.Participants),
+			}
+
+			// Get additional info
+			info, err := session.GetClient().GetGroupInfo(group.JID)
+			if err == nil {
+				groupInfo.Topic = info.Topic
+				groupInfo.IsAnnounce = info.IsAnnounce
+			}
+
+			groupsList = append(groupsList, groupInfo)
+		}
 	}
 
-	h.logger.Info("Groups list retrieved", "total", len(groupsList))
+	requestLogger(h.logger, r).Info("Groups list retrieved", "total", len(groupsList))
 	h.sendSuccessResponse(w, groupsList)
 }
 
@@ -1,54 +1,217 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"whatsapp-h2h-otomax/internal/config"
+	"whatsapp-h2h-otomax/internal/repository"
 	"whatsapp-h2h-otomax/internal/service"
 	"whatsapp-h2h-otomax/pkg/logger"
 )
 
+// healthCheckTimeout bounds the dependency checks of a readiness probe
+const healthCheckTimeout = 3 * time.Second
+
+// webhookDownAfterFailures is the number of failed webhook calls in a row before the
+// webhook is reported down; a single failure is retried by the outbox anyway
+const webhookDownAfterFailures = 3
+
+// Component states of a readiness check
+const (
+	ComponentUp   = "up"
+	ComponentDown = "down"
+)
+
 // HealthHandler handles health check requests
 type HealthHandler struct {
-	whatsappService *service.WhatsAppService
+	whatsappService *service.SessionPool
+	transactionRepo *repository.TransactionRepository
+	otomaxService   *service.OtomaxService
 	config          *config.Config
 	logger          *logger.Logger
 	startTime       time.Time
+
+	// Last reported state of each component, to log only changes
+	stateMu sync.Mutex
+	states  map[string]string
 }
 
 // NewHealthHandler creates a new health handler
-func NewHealthHandler(waService *service.WhatsAppService, cfg *config.Config, log *logger.Logger) *HealthHandler {
+func NewHealthHandler(waService *service.SessionPool, repo *repository.TransactionRepository, otomaxService *service.OtomaxService, cfg *config.Config, log *logger.Logger) *HealthHandler {
 	return &HealthHandler{
 		whatsappService: waService,
+		transactionRepo: repo,
+		otomaxService:   otomaxService,
 		config:          cfg,
 		logger:          log,
 		startTime:       time.Now(),
+		states:          make(map[string]string),
 	}
 }
 
-// CheckHealth handles GET /health
-func (h *HealthHandler) CheckHealth(w http.ResponseWriter, r *http.Request) {
-	// Get WhatsApp connection status
-	waStatus := h.whatsappService.GetConnectionStatus()
+// ComponentHealth represents the result of checking one dependency
+type ComponentHealth struct {
+	Status  string      `json:"status"` // "up" or "down"
+	Message string      `json:"message,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Live handles GET /health/live
+// The process is alive as long as it can answer, dependencies are not checked
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	h.sendJSON(w, map[string]interface{}{
+		"status":    "alive",
+		"uptime":    time.Since(h.startTime).String(),
+		"timestamp": time.Now().Format(time.RFC3339),
+	}, http.StatusOK)
+}
+
+// Ready handles GET /health/ready (and GET /health)
+// Returns 503 if any dependency is down, with the result of each check
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	checks := map[string]ComponentHealth{
+		"whatsapp":       h.checkWhatsApp(),
+		"database":       h.checkDatabase(ctx),
+		"otomax_webhook": h.checkWebhook(),
+	}
 
-	// Calculate uptime
-	uptime := time.Since(h.startTime)
+	status := "healthy"
+	statusCode := http.StatusOK
+	for name, check := range checks {
+		if check.Status != ComponentUp {
+			status = "unhealthy"
+			statusCode = http.StatusServiceUnavailable
+		}
+		h.logStateChange(name, check)
+	}
 
-	response := map[string]interface{}{
-		"status": "healthy",
-		"whatsapp": waStatus,
-		"otomax_webhook": map[string]interface{}{
-			"configured": h.config.Otomax.WebhookURL != "",
-			"url":        h.config.Otomax.WebhookURL,
-		},
-		"uptime":    uptime.String(),
+	h.sendJSON(w, map[string]interface{}{
+		"status":    status,
+		"checks":    checks,
+		"whatsapp":  h.whatsappService.GetConnectionStatus(),
+		"uptime":    time.Since(h.startTime).String(),
 		"timestamp": time.Now().Format(time.RFC3339),
+	}, statusCode)
+}
+
+// logStateChange logs when a component goes down or recovers, not on every probe
+func (h *HealthHandler) logStateChange(name string, check ComponentHealth) {
+	h.stateMu.Lock()
+	previous, known := h.states[name]
+	h.states[name] = check.Status
+	h.stateMu.Unlock()
+
+	switch {
+	case previous == check.Status:
+	case check.Status != ComponentUp:
+		h.logger.Warn("Health check failed", "component", name, "message", check.Message)
+	case known:
+		h.logger.Info("Health check recovered", "component", name)
+	}
+}
+
+// checkWhatsApp requires at least one linked device that is connected and logged in
+func (h *HealthHandler) checkWhatsApp() ComponentHealth {
+	linked, ready := 0, 0
+	for _, session := range h.whatsappService.Sessions() {
+		if session.ID() == "" {
+			continue
+		}
+		linked++
+		if session.IsConnected() && session.IsLoggedIn() {
+			ready++
+		}
+	}
+
+	details := map[string]int{
+		"linked_devices": linked,
+		"ready_devices":  ready,
+	}
+	switch {
+	case linked == 0:
+		return ComponentHealth{Status: ComponentDown, Message: "no linked device, pair one through /api/v1/session/qr", Details: details}
+	case ready == 0:
+		return ComponentHealth{Status: ComponentDown, Message: "no device connected and logged in", Details: details}
 	}
+	return ComponentHealth{Status: ComponentUp, Details: details}
+}
+
+// checkDatabase pings the tracking database and writes a probe row
+func (h *HealthHandler) checkDatabase(ctx context.Context) ComponentHealth {
+	start := time.Now()
+	if err := h.transactionRepo.Ping(ctx); err != nil {
+		return ComponentHealth{Status: ComponentDown, Message: err.Error()}
+	}
+	return ComponentHealth{Status: ComponentUp, Details: map[string]int64{
+		"latency_ms": time.Since(start).Milliseconds(),
+	}}
+}
+
+// checkWebhook reports the outcome of the last calls to the Otomax webhook. The webhook
+// is down after several failed calls in a row; without any call since start it is assumed up.
+func (h *HealthHandler) checkWebhook() ComponentHealth {
+	details := map[string]interface{}{
+		"configured": h.config.Otomax.WebhookURL != "",
+		"url":        redactURL(h.config.Otomax.WebhookURL),
+	}
+	if h.config.Otomax.AlertURL != "" {
+		details["alert_url"] = redactURL(h.config.Otomax.AlertURL)
+	}
+	if pending, err := h.otomaxService.CountDeliveries(repository.WebhookStatusPending); err == nil {
+		details["pending_deliveries"] = pending
+	}
+
+	if h.config.Otomax.WebhookURL == "" {
+		return ComponentHealth{Status: ComponentDown, Message: "OTOMAX_WEBHOOK_URL is not configured", Details: details}
+	}
+
+	last := h.otomaxService.LastAttempt()
+	if last == nil {
+		return ComponentHealth{Status: ComponentUp, Message: "no webhook call since start", Details: details}
+	}
+	// HTTP client errors quote the full webhook URL
+	last.Error = strings.ReplaceAll(last.Error, h.config.Otomax.WebhookURL, redactURL(h.config.Otomax.WebhookURL))
+	details["last_attempt"] = last
+
+	if last.ConsecutiveFailures >= webhookDownAfterFailures {
+		return ComponentHealth{Status: ComponentDown, Message: fmt.Sprintf("last %d webhook calls failed: %s", last.ConsecutiveFailures, last.Error), Details: details}
+	}
+	if last.Error != "" {
+		return ComponentHealth{Status: ComponentUp, Message: "last webhook call failed, retrying: " + last.Error, Details: details}
+	}
+	return ComponentHealth{Status: ComponentUp, Details: details}
+}
 
+// redactURL keeps only scheme and host of a URL, path and query may carry secrets
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "[redacted]"
+	}
+	redacted := u.Scheme + "://" + u.Host
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		redacted += "/[redacted]"
+	}
+	return redacted
+}
+
+// sendJSON sends JSON response
+func (h *HealthHandler) sendJSON(w http.ResponseWriter, response interface{}, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(response)
 }
-
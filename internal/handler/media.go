@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"whatsapp-h2h-otomax/internal/service"
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+// MediaHandler serves media received from WhatsApp
+type MediaHandler struct {
+	mediaService *service.MediaService
+	logger       *logger.Logger
+}
+
+// NewMediaHandler creates a new media handler
+func NewMediaHandler(mediaService *service.MediaService, log *logger.Logger) *MediaHandler {
+	return &MediaHandler{
+		mediaService: mediaService,
+		logger:       log,
+	}
+}
+
+// GetMedia handles GET /api/v1/media/{id}
+func (h *MediaHandler) GetMedia(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	record, err := h.mediaService.Get(id)
+	if err != nil {
+		requestLogger(h.logger, r).Error("Failed to get media", "error", err, "media_id", id)
+		h.sendErrorResponse(w, "Failed to retrieve media", http.StatusInternalServerError)
+		return
+	}
+	if record == nil {
+		h.sendErrorResponse(w, "Media not found or expired", http.StatusNotFound)
+		return
+	}
+
+	file, err := os.Open(record.Path)
+	if err != nil {
+		requestLogger(h.logger, r).Error("Failed to open media file", "error", err, "media_id", id)
+		h.sendErrorResponse(w, "Media not found or expired", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	fileName := record.FileName
+	if fileName == "" {
+		fileName = filepath.Base(record.Path)
+	}
+
+	if record.MimeType != "" {
+		w.Header().Set("Content-Type", record.MimeType)
+	}
+	if disposition := mime.FormatMediaType("inline", map[string]string{"filename": fileName}); disposition != "" {
+		w.Header().Set("Content-Disposition", disposition)
+	}
+	http.ServeContent(w, r, fileName, record.CreatedAt, file)
+}
+
+// sendErrorResponse sends error response
+func (h *MediaHandler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "error",
+		"message": message,
+	})
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+
+	"whatsapp-h2h-otomax/internal/service"
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+// qrImageSize is the width and height in pixels of the login QR code PNG
+const qrImageSize = 512
+
+// SessionHandler handles remote login (QR code / pairing code), status and logout of WhatsApp devices
+type SessionHandler struct {
+	sessions *service.SessionPool
+	logger   *logger.Logger
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(pool *service.SessionPool, log *logger.Logger) *SessionHandler {
+	return &SessionHandler{
+		sessions: pool,
+		logger:   log,
+	}
+}
+
+// LoginQR represents the login QR code for API response
+type LoginQR struct {
+	Code      string    `json:"code"` // Raw QR string, render it as QR code to scan
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PairCode represents a pairing code for API response
+type PairCode struct {
+	Phone string `json:"phone"`
+	Code  string `json:"code"` // Enter in WhatsApp: Linked Devices > Link with phone number
+}
+
+// SessionResponse represents the API response
+type SessionResponse struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// GetStatus handles GET /api/v1/session/status
+func (h *SessionHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	h.sendResponse(w, "success", "Session status retrieved successfully", h.sessions.GetConnectionStatus(), http.StatusOK)
+}
+
+// GetQR handles GET /api/v1/session/qr
+// Returns the login QR code of the device waiting to be paired as PNG,
+// or as raw string with ?format=text. A new login is started if the previous one timed out.
+func (h *SessionHandler) GetQR(w http.ResponseWriter, r *http.Request) {
+	session := h.sessions.Pending()
+	if session == nil {
+		h.sendResponse(w, "error", "No device waiting for pairing (logout a device or set WA_ADD_DEVICE=true)", nil, http.StatusConflict)
+		return
+	}
+
+	code, expiresAt, err := session.LoginQR(r.Context())
+	if err != nil {
+		requestLogger(h.logger, r).Error("Failed to get login QR code", "error", err)
+		h.sendResponse(w, "error", err.Error(), nil, http.StatusServiceUnavailable)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "png":
+		png, err := qrcode.Encode(code, qrcode.Medium, qrImageSize)
+		if err != nil {
+			requestLogger(h.logger, r).Error("Failed to generate QR code PNG", "error", err)
+			h.sendResponse(w, "error", "Failed to generate QR code", nil, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", strconv.Itoa(len(png)))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-QR-Expires-At", expiresAt.Format(time.RFC3339))
+		w.WriteHeader(http.StatusOK)
+		w.Write(png)
+	case "text":
+		h.sendResponse(w, "success", "Login QR code retrieved successfully", LoginQR{
+			Code:      code,
+			ExpiresAt: expiresAt,
+		}, http.StatusOK)
+	default:
+		h.sendResponse(w, "error", "Invalid format parameter (use png or text)", nil, http.StatusBadRequest)
+	}
+}
+
+// RequestPairCode handles POST /api/v1/session/pair-code
+// Links the device waiting to be paired with a pairing code for ?phone= instead of a QR code
+func (h *SessionHandler) RequestPairCode(w http.ResponseWriter, r *http.Request) {
+	phone := r.FormValue("phone")
+	if phone == "" {
+		h.sendResponse(w, "error", "Missing required parameter: phone", nil, http.StatusBadRequest)
+		return
+	}
+
+	session := h.sessions.Pending()
+	if session == nil {
+		h.sendResponse(w, "error", "No device waiting for pairing (logout a device or set WA_ADD_DEVICE=true)", nil, http.StatusConflict)
+		return
+	}
+
+	code, err := session.PairPhone(r.Context(), phone)
+	if err != nil {
+		requestLogger(h.logger, r).Error("Failed to request pairing code", "error", err, "phone", phone)
+		h.sendResponse(w, "error", err.Error(), nil, http.StatusServiceUnavailable)
+		return
+	}
+
+	requestLogger(h.logger, r).Info("Pairing code requested remotely",
+		"phone", phone,
+		"remote_addr", r.RemoteAddr,
+	)
+	h.sendResponse(w, "success", "Pairing code generated, enter it on the phone", PairCode{
+		Phone: phone,
+		Code:  code,
+	}, http.StatusOK)
+}
+
+// Logout handles POST /api/v1/session/logout
+// Unlinks the device of ?sender= (optional with a single linked device); a new
+// device is then waiting for pairing through /api/v1/session/qr or /api/v1/session/pair-code
+func (h *SessionHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	sender := r.FormValue("sender")
+	if sender == "" {
+		linked := make([]string, 0)
+		for _, session := range h.sessions.Sessions() {
+			if session.ID() != "" {
+				linked = append(linked, session.ID())
+			}
+		}
+		if len(linked) != 1 {
+			h.sendResponse(w, "error", "Missing required parameter: sender", nil, http.StatusBadRequest)
+			return
+		}
+		sender = linked[0]
+	}
+
+	if h.sessions.Get(sender) == nil {
+		h.sendResponse(w, "error", "Sender is not a linked device", nil, http.StatusNotFound)
+		return
+	}
+
+	if err := h.sessions.Logout(r.Context(), sender); err != nil {
+		requestLogger(h.logger, r).Error("Failed to logout device", "error", err, "sender", sender)
+		h.sendResponse(w, "error", err.Error(), nil, http.StatusInternalServerError)
+		return
+	}
+
+	requestLogger(h.logger, r).Warn("WhatsApp device logged out remotely",
+		"sender", sender,
+		"remote_addr", r.RemoteAddr,
+	)
+	h.sendResponse(w, "success", "Device logged out, a new device is waiting for pairing", map[string]interface{}{"sender": sender}, http.StatusOK)
+}
+
+// sendResponse sends JSON response
+func (h *SessionHandler) sendResponse(w http.ResponseWriter, status, message string, data interface{}, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	response := SessionResponse{
+		Status:  status,
+		Message: message,
+		Data:    data,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
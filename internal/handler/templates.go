@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"whatsapp-h2h-otomax/internal/model"
+	"whatsapp-h2h-otomax/internal/service"
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+// TemplatesHandler handles message template preview and reload
+type TemplatesHandler struct {
+	transactionService *service.TransactionService
+	templateService    *service.TemplateService
+	logger             *logger.Logger
+}
+
+// NewTemplatesHandler creates a new templates handler
+func NewTemplatesHandler(txService *service.TransactionService, templateService *service.TemplateService, log *logger.Logger) *TemplatesHandler {
+	return &TemplatesHandler{
+		transactionService: txService,
+		templateService:    templateService,
+		logger:             log,
+	}
+}
+
+// RenderedTemplate represents a dry-run rendered message
+type RenderedTemplate struct {
+	Template string `json:"template"` // "destination:<key>", "product:<code>", "default" or "adhoc"
+	Message  string `json:"message"`
+}
+
+// TemplatesResponse represents the API response
+type TemplatesResponse struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// RenderTemplate handles GET /api/v1/templates/render
+// Renders the message a transaction would be sent with, without sending it.
+// Accepts the forward parameters, plus ?template= to try out an ad-hoc template.
+func (h *TemplatesHandler) RenderTemplate(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	req := &model.TransactionRequest{
+		Destination:  query.Get("destination"),
+		TrxID:        query.Get("trxid"),
+		Descriptions: query.Get("descriptions"),
+		Instructions: query.Get("instructions"),
+		Product:      query.Get("product"),
+	}
+
+	message, name, err := h.transactionService.RenderMessage(req, query.Get("template"))
+	if err != nil {
+		h.sendResponse(w, "error", err.Error(), nil, http.StatusUnprocessableEntity)
+		return
+	}
+
+	h.sendResponse(w, "success", "Template rendered successfully", RenderedTemplate{
+		Template: name,
+		Message:  message,
+	}, http.StatusOK)
+}
+
+// ReloadTemplates handles POST /api/v1/templates/reload
+func (h *TemplatesHandler) ReloadTemplates(w http.ResponseWriter, r *http.Request) {
+	if err := h.templateService.Reload(); err != nil {
+		requestLogger(h.logger, r).Error("Failed to reload message templates", "error", err)
+		h.sendResponse(w, "error", err.Error(), nil, http.StatusUnprocessableEntity)
+		return
+	}
+
+	requestLogger(h.logger, r).Info("Message templates reloaded manually", "remote_addr", r.RemoteAddr)
+	h.sendResponse(w, "success", "Message templates reloaded", nil, http.StatusOK)
+}
+
+// sendResponse sends JSON response
+func (h *TemplatesHandler) sendResponse(w http.ResponseWriter, status, message string, data interface{}, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	response := TemplatesResponse{
+		Status:  status,
+		Message: message,
+		Data:    data,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
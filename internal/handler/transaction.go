@@ -2,13 +2,42 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
 	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"whatsapp-h2h-otomax/internal/metrics"
 	"whatsapp-h2h-otomax/internal/model"
+	"whatsapp-h2h-otomax/internal/repository"
 	"whatsapp-h2h-otomax/internal/service"
 	"whatsapp-h2h-otomax/pkg/logger"
 )
 
+// multipartMemory is the part of a multipart upload kept in memory, the rest goes to temp files
+const multipartMemory = 8 << 20
+
+// maxJSONBody is the maximum size of a JSON forward request body
+const maxJSONBody = 1 << 20
+
+// mediaForwardTimeout is the read and write deadline of POST /api/v1/forward: uploads and
+// media_url downloads take longer than the server timeouts, before the message is even sent
+const mediaForwardTimeout = 2 * time.Minute
+
+// Limits of POST /api/v1/forward/batch
+const (
+	maxBatchSize      = 100
+	MaxBatchBody      = 8 << 20
+	batchWriteTimeout = 5 * time.Minute // Sync batches are paced by the rate limiter
+)
+
 // TransactionHandler handles transaction forwarding requests
 type TransactionHandler struct {
 	transactionService *service.TransactionService
@@ -26,50 +55,408 @@ func NewTransactionHandler(txService *service.TransactionService, log *logger.Lo
 // ForwardTransaction handles GET /api/v1/forward
 func (h *TransactionHandler) ForwardTransaction(w http.ResponseWriter, r *http.Request) {
 	// Parse query parameters
-	destination := r.URL.Query().Get("destination")
-	trxID := r.URL.Query().Get("trxid")
-	descriptions := r.URL.Query().Get("descriptions")
-	instructions := r.URL.Query().Get("instructions")
+	req, fieldErrs := parseTransactionRequest(r.URL.Query().Get)
+	if !h.validateRequest(w, req, fieldErrs) {
+		return
+	}
+
+	h.forward(w, r, req)
+}
+
+// ForwardTransactionWithMedia handles POST /api/v1/forward
+// Accepts a JSON body (Content-Type application/json), or the same fields as the GET
+// variant as form values, plus an image or document attachment uploaded as multipart
+// "file" or referenced by "media_url"
+func (h *TransactionHandler) ForwardTransactionWithMedia(w http.ResponseWriter, r *http.Request) {
+	controller := http.NewResponseController(w)
+	deadline := time.Now().Add(mediaForwardTimeout)
+	if err := controller.SetReadDeadline(deadline); err != nil {
+		requestLogger(h.logger, r).Warn("Failed to extend read deadline for media forward", "error", err)
+	}
+	if err := controller.SetWriteDeadline(deadline); err != nil {
+		requestLogger(h.logger, r).Warn("Failed to extend write deadline for media forward", "error", err)
+	}
+
+	if isJSONRequest(r) {
+		h.forwardJSON(w, r)
+		return
+	}
+
+	maxSize := h.transactionService.MaxMediaSize()
+
+	// Allow some room for the other form fields
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.sendErrorResponse(w, "ERR_INVALID_MEDIA", fmt.Sprintf("Media too large (max %d MB)", maxSize>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		h.sendErrorResponse(w, "ERR_INVALID_PARAMETER", "Invalid form data", http.StatusBadRequest)
+		return
+	}
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+
+	req, fieldErrs := parseTransactionRequest(r.FormValue)
+	fieldErrs = append(fieldErrs, unknownFormFields(r)...)
+	req.MediaURL = r.FormValue("media_url")
+	mediaType := r.FormValue("media_type")
+
+	file, header, err := r.FormFile("file")
+	switch {
+	case err == nil:
+		defer file.Close()
+		if req.MediaURL != "" {
+			h.sendErrorResponse(w, "ERR_INVALID_PARAMETER", "Use either file or media_url, not both", http.StatusBadRequest)
+			return
+		}
+		if header.Size > maxSize {
+			h.sendErrorResponse(w, "ERR_INVALID_MEDIA", fmt.Sprintf("Media too large (max %d MB)", maxSize>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		data, err := io.ReadAll(file)
+		if err != nil {
+			h.sendErrorResponse(w, "ERR_INVALID_MEDIA", "Failed to read uploaded file", http.StatusBadRequest)
+			return
+		}
+		req.Media, err = service.NewTransactionMedia(data, header.Header.Get("Content-Type"), filepath.Base(header.Filename), mediaType)
+		if err != nil {
+			h.sendErrorResponse(w, "ERR_INVALID_MEDIA", err.Error(), http.StatusBadRequest)
+			return
+		}
+	case errors.Is(err, http.ErrMissingFile), errors.Is(err, http.ErrNotMultipart):
+		// media_type is validated with the other fields
+		req.MediaType = mediaType
+	default:
+		h.sendErrorResponse(w, "ERR_INVALID_MEDIA", "Failed to read uploaded file", http.StatusBadRequest)
+		return
+	}
 
-	// Validate required parameters
-	if destination == "" || trxID == "" || descriptions == "" || instructions == "" {
-		h.sendErrorResponse(w, "ERR_MISSING_PARAMETER", "Missing required parameters", http.StatusBadRequest)
+	if !h.validateRequest(w, req, fieldErrs) {
+		return
+	}
+	if (req.Media != nil || req.MediaURL != "") && maxSize == 0 {
+		h.sendErrorResponse(w, "ERR_INVALID_MEDIA", "Media attachments are not enabled", http.StatusBadRequest)
 		return
 	}
 
-	// Validate length limits
-	if len(descriptions) > 4096 || len(instructions) > 4096 {
-		h.sendErrorResponse(w, "ERR_INVALID_PARAMETER", "Description or instruction too long (max 4096 chars)", http.StatusBadRequest)
+	h.forward(w, r, req)
+}
+
+// forwardJSON handles POST /api/v1/forward with a JSON body
+func (h *TransactionHandler) forwardJSON(w http.ResponseWriter, r *http.Request) {
+	var raw map[string]json.RawMessage
+	if !h.decodeJSONBody(w, r, &raw, maxJSONBody) {
+		return
+	}
+
+	req, fieldErrs := transactionFromJSON(raw)
+	if !h.validateRequest(w, req, fieldErrs) {
+		return
+	}
+	if req.MediaURL != "" && h.transactionService.MaxMediaSize() == 0 {
+		h.sendErrorResponse(w, "ERR_INVALID_MEDIA", "Media attachments are not enabled", http.StatusBadRequest)
+		return
+	}
+
+	h.forward(w, r, req)
+}
+
+// ForwardBatch handles POST /api/v1/forward/batch
+// Accepts a JSON array of transactions with the fields of the JSON forward request. Every
+// transaction is validated and processed on its own, the response has a result per item.
+func (h *TransactionHandler) ForwardBatch(w http.ResponseWriter, r *http.Request) {
+	if !isJSONRequest(r) {
+		h.sendErrorResponse(w, "ERR_INVALID_PARAMETER", "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var items []json.RawMessage
+	if !h.decodeJSONBody(w, r, &items, MaxBatchBody) {
+		return
+	}
+	if len(items) == 0 {
+		h.sendErrorResponse(w, "ERR_MISSING_PARAMETER", "Batch contains no transactions", http.StatusBadRequest)
+		return
+	}
+	if len(items) > maxBatchSize {
+		h.sendErrorResponse(w, "ERR_INVALID_PARAMETER", fmt.Sprintf("Batch too large (%d transactions, max %d)", len(items), maxBatchSize), http.StatusBadRequest)
 		return
 	}
 
-	h.logger.WithTrxID(trxID).Info("New transaction request", 
-		"destination", destination,
+	// Sending a large batch takes longer than the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(batchWriteTimeout)); err != nil {
+		requestLogger(h.logger, r).Warn("Failed to extend write deadline for batch", "error", err)
+	}
+
+	apiKey := apiKeyName(r)
+	mediaEnabled := h.transactionService.MaxMediaSize() > 0
+	results := make([]model.BatchItemResult, len(items))
+	var valid []*model.TransactionRequest
+	var validIndexes []int
+
+	for i, item := range items {
+		results[i].Index = i
+
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(item, &raw); err != nil || raw == nil {
+			results[i].Status = "error"
+			results[i].Error = &model.TransactionError{Code: "ERR_INVALID_PARAMETER", Message: "Transaction must be a JSON object"}
+			continue
+		}
+
+		req, fieldErrs := transactionFromJSON(raw)
+		req.APIKey = apiKey
+		results[i].TrxID = req.TrxID
+		if fieldErrs = validationErrors(req, fieldErrs); len(fieldErrs) > 0 {
+			code, message := fieldErrorCode(fieldErrs)
+			results[i].Status = "error"
+			results[i].Error = &model.TransactionError{Code: code, Message: message, Fields: fieldErrs}
+			continue
+		}
+		if req.MediaURL != "" && !mediaEnabled {
+			results[i].Status = "error"
+			results[i].Error = &model.TransactionError{Code: "ERR_INVALID_MEDIA", Message: "Media attachments are not enabled"}
+			continue
+		}
+
+		valid = append(valid, req)
+		validIndexes = append(validIndexes, i)
+	}
+
+	requestLogger(h.logger, r).Info("New batch transaction request",
+		"transactions", len(items),
+		"valid", len(valid),
 	)
 
-	// Create request model
+	outcomes := h.transactionService.ProcessBatch(r.Context(), valid)
+	for j, outcome := range outcomes {
+		i := validIndexes[j]
+		req := valid[j]
+
+		code := "OK"
+		if outcome.Err != nil {
+			var statusCode int
+			code, statusCode = mapServiceError(outcome.Err)
+			log := requestLogger(h.logger, r).WithTrxID(req.TrxID)
+			if statusCode >= http.StatusInternalServerError {
+				log.Error("Failed to process batch transaction", "error", outcome.Err, "error_code", code, "destination", req.Destination)
+			} else {
+				log.Warn("Batch transaction rejected", "error", outcome.Err, "error_code", code, "destination", req.Destination)
+			}
+			results[i].Status = "error"
+			results[i].Error = &model.TransactionError{Code: code, Message: outcome.Err.Error()}
+		} else {
+			results[i].Status = "success"
+			results[i].Data = outcome.Data
+		}
+		metrics.ObserveForward(service.DestinationType(req.Destination), code)
+	}
+
+	data := &model.BatchData{Total: len(results), Results: results}
+	for _, result := range results {
+		if result.Status == "success" {
+			data.Succeeded++
+		} else {
+			data.Failed++
+		}
+	}
+
+	h.sendBatchResponse(w, data)
+}
+
+// decodeJSONBody decodes a JSON request body of at most maxBytes into v.
+// Writes the error response and returns false if the body is not valid JSON.
+func (h *TransactionHandler) decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}, maxBytes int64) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	err := decoder.Decode(v)
+	if err == nil {
+		// Reject trailing data after the JSON value
+		if _, tokenErr := decoder.Token(); tokenErr != io.EOF {
+			err = errors.New("unexpected data after JSON value")
+		}
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.sendErrorResponse(w, "ERR_INVALID_PARAMETER", fmt.Sprintf("Request body too large (max %d KB)", maxBytes>>10), http.StatusRequestEntityTooLarge)
+			return false
+		}
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			h.sendErrorResponse(w, "ERR_INVALID_PARAMETER", "Invalid JSON body: unexpected "+typeErr.Value, http.StatusBadRequest)
+			return false
+		}
+		h.sendErrorResponse(w, "ERR_INVALID_PARAMETER", "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// validateRequest validates a transaction request, together with the errors found while parsing it.
+// Writes the error response with all invalid fields and returns false if the request is invalid.
+func (h *TransactionHandler) validateRequest(w http.ResponseWriter, req *model.TransactionRequest, fieldErrs []model.FieldError) bool {
+	fieldErrs = validationErrors(req, fieldErrs)
+	if len(fieldErrs) == 0 {
+		return true
+	}
+
+	code, message := fieldErrorCode(fieldErrs)
+	h.sendFieldErrorResponse(w, code, message, fieldErrs)
+	return false
+}
+
+// parseTransactionRequest reads the transaction fields of the GET and form variants.
+// Returns the request and the fields that can't be parsed; use Validate for the rest.
+func parseTransactionRequest(get func(string) string) (*model.TransactionRequest, []model.FieldError) {
 	req := &model.TransactionRequest{
-		Destination:  destination,
-		TrxID:        trxID,
-		Descriptions: descriptions,
-		Instructions: instructions,
+		Destination:  get("destination"),
+		TrxID:        get("trxid"),
+		Descriptions: get("descriptions"),
+		Instructions: get("instructions"),
+		Product:      get("product"),
+		Sender:       get("sender"),
+	}
+
+	// Optional async mode: queue and deliver in background
+	var fieldErrs []model.FieldError
+	if value := get("async"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			fieldErrs = append(fieldErrs, model.FieldError{Field: "async", Reason: model.FieldErrorInvalid, Message: "async must be true or false"})
+		}
+		req.Async = parsed
+	}
+
+	return req, fieldErrs
+}
+
+// formFields are the fields accepted in the body of a form POST /api/v1/forward
+var formFields = []string{"destination", "trxid", "descriptions", "instructions", "product", "sender", "async", "media_url", "media_type", "file"}
+
+// unknownFormFields returns a field error for every field of a form body that
+// isn't a transaction field, like transactionFromJSON does for JSON
+func unknownFormFields(r *http.Request) []model.FieldError {
+	names := slices.Collect(maps.Keys(r.PostForm))
+	if r.MultipartForm != nil {
+		names = slices.AppendSeq(names, maps.Keys(r.MultipartForm.File))
+	}
+	slices.Sort(names)
+
+	var fieldErrs []model.FieldError
+	for _, name := range slices.Compact(names) {
+		if !slices.Contains(formFields, name) {
+			fieldErrs = append(fieldErrs, model.FieldError{Field: name, Reason: model.FieldErrorUnknown, Message: "unknown field " + name})
+		}
+	}
+	return fieldErrs
+}
+
+// transactionFromJSON maps the fields of a JSON object to a transaction request.
+// Unknown fields and fields of the wrong type are returned as field errors.
+func transactionFromJSON(raw map[string]json.RawMessage) (*model.TransactionRequest, []model.FieldError) {
+	req := &model.TransactionRequest{}
+	stringFields := map[string]*string{
+		"destination":  &req.Destination,
+		"trxid":        &req.TrxID,
+		"descriptions": &req.Descriptions,
+		"instructions": &req.Instructions,
+		"product":      &req.Product,
+		"sender":       &req.Sender,
+		"media_url":    &req.MediaURL,
+		"media_type":   &req.MediaType,
+	}
+
+	var fieldErrs []model.FieldError
+	for _, name := range slices.Sorted(maps.Keys(raw)) {
+		value := raw[name]
+		if target, ok := stringFields[name]; ok {
+			if err := json.Unmarshal(value, target); err != nil {
+				fieldErrs = append(fieldErrs, model.FieldError{Field: name, Reason: model.FieldErrorInvalid, Message: name + " must be a string"})
+			}
+			continue
+		}
+		if name == "async" {
+			if err := json.Unmarshal(value, &req.Async); err != nil {
+				fieldErrs = append(fieldErrs, model.FieldError{Field: name, Reason: model.FieldErrorInvalid, Message: "async must be true or false"})
+			}
+			continue
+		}
+		fieldErrs = append(fieldErrs, model.FieldError{Field: name, Reason: model.FieldErrorUnknown, Message: "unknown field " + name})
 	}
 
+	return req, fieldErrs
+}
+
+// validationErrors returns the parse errors followed by the validation errors of the
+// fields that were parsed, so a field of the wrong type isn't also reported as missing
+func validationErrors(req *model.TransactionRequest, parseErrs []model.FieldError) []model.FieldError {
+	fieldErrs := parseErrs
+	for _, fieldErr := range req.Validate() {
+		if !slices.ContainsFunc(parseErrs, func(parseErr model.FieldError) bool { return parseErr.Field == fieldErr.Field }) {
+			fieldErrs = append(fieldErrs, fieldErr)
+		}
+	}
+	return fieldErrs
+}
+
+// fieldErrorCode returns the error code and message for a list of invalid fields
+func fieldErrorCode(fieldErrs []model.FieldError) (string, string) {
+	messages := make([]string, 0, len(fieldErrs))
+	for _, fieldErr := range fieldErrs {
+		messages = append(messages, fieldErr.Message)
+	}
+	if model.HasRequiredFieldError(fieldErrs) {
+		return "ERR_MISSING_PARAMETER", "Missing required parameters: " + strings.Join(messages, "; ")
+	}
+	return "ERR_INVALID_PARAMETER", "Invalid parameters: " + strings.Join(messages, "; ")
+}
+
+// isJSONRequest reports whether the request body is JSON
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// forward processes a validated transaction request and writes the response
+func (h *TransactionHandler) forward(w http.ResponseWriter, r *http.Request, req *model.TransactionRequest) {
+	trxID := req.TrxID
+	req.APIKey = apiKeyName(r)
+
+	requestLogger(h.logger, r).WithTrxID(trxID).Info("New transaction request", 
+		"destination", req.Destination,
+		"sender", req.Sender,
+		"has_media", req.Media != nil || req.MediaURL != "",
+	)
+
+	// Count the outcome for /metrics
+	code := "OK"
+	defer func() {
+		metrics.ObserveForward(service.DestinationType(req.Destination), code)
+	}()
+
 	// Process transaction
 	data, err := h.transactionService.ProcessTransaction(r.Context(), req)
 	if err != nil {
-		// Check for duplicate error
-		if contains(err.Error(), "duplicate transaction") {
-			h.logger.WithTrxID(trxID).Warn("Duplicate transaction detected", "error", err)
-			h.sendErrorResponse(w, "ERR_DUPLICATE_TRANSACTION", err.Error(), http.StatusConflict)
-			return
+		var statusCode int
+		code, statusCode = mapServiceError(err)
+
+		if statusCode >= http.StatusInternalServerError {
+			requestLogger(h.logger, r).WithTrxID(trxID).Error("Failed to process transaction",
+				"error", err,
+				"error_code", code,
+				"destination", req.Destination,
+			)
+		} else {
+			requestLogger(h.logger, r).WithTrxID(trxID).Warn("Transaction rejected",
+				"error", err,
+				"error_code", code,
+				"destination", req.Destination,
+			)
 		}
-		
-		h.logger.WithTrxID(trxID).Error("Failed to process transaction",
-			"error", err,
-			"destination", destination,
-		)
-		h.sendErrorResponse(w, h.mapErrorCode(err), err.Error(), http.StatusInternalServerError)
+		h.sendErrorResponse(w, code, err.Error(), statusCode)
 		return
 	}
 
@@ -77,24 +464,143 @@ func (h *TransactionHandler) ForwardTransaction(w http.ResponseWriter, r *http.R
 	h.sendSuccessResponse(w, data)
 }
 
+// GetTransaction handles GET /api/v1/transactions/{trxid}
+func (h *TransactionHandler) GetTransaction(w http.ResponseWriter, r *http.Request) {
+	trxID := r.PathValue("trxid")
+
+	detail, err := h.transactionService.GetTransactionDetail(trxID)
+	if err != nil {
+		requestLogger(h.logger, r).WithTrxID(trxID).Error("Failed to get transaction", "error", err)
+		h.sendDetailResponse(w, nil, "ERR_INTERNAL_SERVER", "Failed to retrieve transaction", http.StatusInternalServerError)
+		return
+	}
+	if detail == nil {
+		h.sendDetailResponse(w, nil, "ERR_TRANSACTION_NOT_FOUND", "Transaction not found", http.StatusNotFound)
+		return
+	}
+
+	h.sendDetailResponse(w, detail, "", "Transaction retrieved successfully", http.StatusOK)
+}
+
+// TransactionMessages represents the conversation of a transaction
+type TransactionMessages struct {
+	TrxID    string                      `json:"trxid"`
+	Messages []*repository.MessageRecord `json:"messages"`
+}
+
+// TransactionMessagesResponse represents response for the conversation of a transaction
+type TransactionMessagesResponse struct {
+	Status  string                  `json:"status"`
+	Message string                  `json:"message"`
+	Data    *TransactionMessages    `json:"data,omitempty"`
+	Error   *model.TransactionError `json:"error,omitempty"`
+}
+
+// GetTransactionMessages handles GET /api/v1/transactions/{trxid}/messages
+func (h *TransactionHandler) GetTransactionMessages(w http.ResponseWriter, r *http.Request) {
+	trxID := r.PathValue("trxid")
+
+	messages, err := h.transactionService.GetTransactionMessages(trxID)
+	if err != nil {
+		requestLogger(h.logger, r).WithTrxID(trxID).Error("Failed to get transaction messages", "error", err)
+		h.sendMessagesResponse(w, nil, "ERR_INTERNAL_SERVER", "Failed to retrieve transaction messages", http.StatusInternalServerError)
+		return
+	}
+	if messages == nil {
+		h.sendMessagesResponse(w, nil, "ERR_TRANSACTION_NOT_FOUND", "Transaction not found", http.StatusNotFound)
+		return
+	}
+
+	data := &TransactionMessages{TrxID: trxID, Messages: messages}
+	h.sendMessagesResponse(w, data, "", "Transaction messages retrieved successfully", http.StatusOK)
+}
+
+// sendMessagesResponse sends transaction conversation response
+func (h *TransactionHandler) sendMessagesResponse(w http.ResponseWriter, data *TransactionMessages, code, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	response := TransactionMessagesResponse{
+		Status:  "success",
+		Message: message,
+		Data:    data,
+	}
+	if code != "" {
+		response.Status = "error"
+		response.Error = &model.TransactionError{
+			Code:    code,
+			Message: message,
+		}
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// sendDetailResponse sends transaction lookup response
+func (h *TransactionHandler) sendDetailResponse(w http.ResponseWriter, detail *model.TransactionDetail, code, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	response := model.TransactionDetailResponse{
+		Status:  "success",
+		Message: message,
+		Data:    detail,
+	}
+	if code != "" {
+		response.Status = "error"
+		response.Error = &model.TransactionError{
+			Code:    code,
+			Message: message,
+		}
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
 // sendSuccessResponse sends success response
 func (h *TransactionHandler) sendSuccessResponse(w http.ResponseWriter, data *model.TransactionData) {
+	statusCode := http.StatusOK
+	message := "Transaction forwarded successfully"
+	if data.IdempotentReplay && data.Status == repository.TransactionStatusPending {
+		statusCode = http.StatusAccepted
+		message = "Transaction already received and still being sent"
+	} else if data.IdempotentReplay {
+		message = "Transaction already forwarded, returning original result"
+	} else if data.Delivery == service.DeliveryAsync {
+		statusCode = http.StatusAccepted
+		message = "Transaction queued for delivery"
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(statusCode)
 
 	response := model.TransactionResponse{
 		Status:  "success",
-		Message: "Transaction forwarded successfully",
+		Message: message,
 		Data:    data,
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
-// sendErrorResponse sends error response
-func (h *TransactionHandler) sendErrorResponse(w http.ResponseWriter, code, message string, statusCode int) {
+// sendBatchResponse sends the per-item results of a batch
+func (h *TransactionHandler) sendBatchResponse(w http.ResponseWriter, data *model.BatchData) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+	w.WriteHeader(http.StatusOK)
+
+	response := model.BatchResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Batch processed: %d succeeded, %d failed", data.Succeeded, data.Failed),
+		Data:    data,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// sendFieldErrorResponse sends a validation error response with the invalid fields
+func (h *TransactionHandler) sendFieldErrorResponse(w http.ResponseWriter, code, message string, fieldErrs []model.FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
 
 	response := model.TransactionResponse{
 		Status:  "error",
@@ -102,45 +608,26 @@ func (h *TransactionHandler) sendErrorResponse(w http.ResponseWriter, code, mess
 		Error: &model.TransactionError{
 			Code:    code,
 			Message: message,
+			Fields:  fieldErrs,
 		},
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
-// mapErrorCode maps error to error code
-func (h *TransactionHandler) mapErrorCode(err error) string {
-	errMsg := err.Error()
+// sendErrorResponse sends error response
+func (h *TransactionHandler) sendErrorResponse(w http.ResponseWriter, code, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
 
-	switch {
-	case contains(errMsg, "invalid destination"):
-		return "ERR_INVALID_DESTINATION"
-	case contains(errMsg, "not connected"):
-		return "ERR_WHATSAPP_NOT_CONNECTED"
-	case contains(errMsg, "group not found"):
-		return "ERR_GROUP_NOT_FOUND"
-	case contains(errMsg, "not registered on WhatsApp"):
-		return "ERR_DESTINATION_NOT_ON_WHATSAPP"
-	case contains(errMsg, "failed to send"):
-		return "ERR_MESSAGE_SEND_FAILED"
-	default:
-		return "ERR_INTERNAL_SERVER"
+	response := model.TransactionResponse{
+		Status:  "error",
+		Message: message,
+		Error: &model.TransactionError{
+			Code:    code,
+			Message: message,
+		},
 	}
-}
 
-// contains checks if string contains substring
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(substr) == 0 || 
-		(len(s) > 0 && len(substr) > 0 && s[:len(s)] != s[:0] && s[len(s)-len(s):] != s[:0] && 
-		findSubstring(s, substr)))
-}
-
-func findSubstring(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
-	}
-	return false
+	json.NewEncoder(w).Encode(response)
 }
-
@@ -26,7 +26,7 @@ func NewWebhookHandler(cfg *config.Config, log *logger.Logger) *WebhookHandler {
 // Note: This endpoint is currently handled by WhatsApp event handler internally
 // This can be used for testing or manual webhook triggers
 func (h *WebhookHandler) ReceiveMessage(w http.ResponseWriter, r *http.Request) {
-	h.logger.Info("Webhook message endpoint called",
+	requestLogger(h.logger, r).Info("Webhook message endpoint called",
 		"method", r.Method,
 		"remote_addr", r.RemoteAddr,
 	)
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes all metric names
+const namespace = "whatsapp_h2h"
+
+// Results of an incoming WhatsApp message
+const (
+	IncomingMatched        = "matched"
+	IncomingUnmatched      = "unmatched"
+	IncomingNotWhitelisted = "not_whitelisted"
+	IncomingError          = "error"
+)
+
+var (
+	forwardsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "forwards_total",
+		Help:      "Forward requests by destination type and result code (OK or API error code).",
+	}, []string{"destination_type", "code"})
+
+	sendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "send_message_duration_seconds",
+		Help:      "Latency of sending a message to WhatsApp by message type and result.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+	}, []string{"type", "result"})
+
+	incomingTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "incoming_messages_total",
+		Help:      "Incoming WhatsApp messages by correlation result (matched, unmatched, not_whitelisted, error).",
+	}, []string{"result"})
+
+	webhookAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_attempts_total",
+		Help:      "Webhook delivery attempts by target (otomax or alert) and HTTP status code (error if no response).",
+	}, []string{"target", "status_code"})
+)
+
+// Handler returns the HTTP handler serving the metrics in Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveForward counts a forward request
+func ObserveForward(destinationType, code string) {
+	forwardsTotal.WithLabelValues(destinationType, code).Inc()
+}
+
+// ObserveSend records the latency of sending a message to WhatsApp
+func ObserveSend(messageType string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	sendDuration.WithLabelValues(messageType, result).Observe(duration.Seconds())
+}
+
+// ObserveIncoming counts an incoming WhatsApp message
+func ObserveIncoming(result string) {
+	incomingTotal.WithLabelValues(result).Inc()
+}
+
+// ObserveWebhookAttempt counts a webhook delivery attempt, statusCode 0 means no response
+func ObserveWebhookAttempt(target string, statusCode int) {
+	code := "error"
+	if statusCode > 0 {
+		code = strconv.Itoa(statusCode)
+	}
+	webhookAttemptsTotal.WithLabelValues(target, code).Inc()
+}
+
+// RegisterTrackedTransactions exposes the number of active tracked transactions,
+// counted on every scrape. The gauge is NaN if counting fails.
+func RegisterTrackedTransactions(count func() (int64, error)) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tracked_transactions",
+		Help:      "Transactions currently tracked for replies (not expired).",
+	}, func() float64 {
+		n, err := count()
+		if err != nil {
+			return math.NaN()
+		}
+		return float64(n)
+	})
+}
@@ -1,41 +1,71 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/netip"
+	"time"
 
 	"whatsapp-h2h-otomax/internal/model"
+	"whatsapp-h2h-otomax/internal/service"
 	"whatsapp-h2h-otomax/pkg/logger"
 )
 
+// apiKeyContextKey is the request context key of the authenticated API key
+type apiKeyContextKey struct{}
+
+// localKey is used for requests while no API key is configured (local mode)
+var localKey = &model.APIKey{Name: "local", Scopes: []string{model.ScopeAdmin}}
+
 // AuthMiddleware provides API key authentication
 type AuthMiddleware struct {
-	apiKey string
+	keys   *service.APIKeyService
 	logger *logger.Logger
+
+	// Restrictions of the forward API, see RestrictForward
+	allowedIPs         []netip.Prefix
+	trustedProxies     []netip.Prefix
+	signingSecret      []byte
+	signatureTolerance time.Duration
+	maxSignedBody      int64
+	nonces             *nonceCache
 }
 
 // NewAuthMiddleware creates a new authentication middleware
-func NewAuthMiddleware(apiKey string, log *logger.Logger) *AuthMiddleware {
+func NewAuthMiddleware(keys *service.APIKeyService, log *logger.Logger) *AuthMiddleware {
 	return &AuthMiddleware{
-		apiKey: apiKey,
+		keys:   keys,
 		logger: log,
 	}
 }
 
-// Authenticate validates API key from request header
+// APIKeyFromContext returns the API key that made the request, or nil if not authenticated
+func APIKeyFromContext(ctx context.Context) *model.APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*model.APIKey)
+	return key
+}
+
+// Authenticate validates API key from request header, any scope is accepted
 func (m *AuthMiddleware) Authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return m.RequireScope("", next)
+}
+
+// RequireScope validates API key from request header and requires the key to grant the scope
+func (m *AuthMiddleware) RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Skip authentication if API_KEY is not configured (local mode)
-		if m.apiKey == "" {
+		// Skip authentication if no API key is configured (local mode)
+		if !m.keys.Enabled() {
 			m.logger.Debug("API authentication disabled (running in local mode)",
 				"path", r.URL.Path,
 				"method", r.Method,
 			)
-			next(w, r)
+			next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, localKey)))
 			return
 		}
 
-		// API_KEY is configured, validate it
+		// API keys are configured, validate it
 		apiKey := r.Header.Get("X-API-Key")
 
 		if apiKey == "" {
@@ -48,7 +78,8 @@ func (m *AuthMiddleware) Authenticate(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		if apiKey != m.apiKey {
+		match := m.keys.Authenticate(apiKey)
+		if match == nil {
 			m.logger.Warn("Invalid API key",
 				"path", r.URL.Path,
 				"method", r.Method,
@@ -58,8 +89,35 @@ func (m *AuthMiddleware) Authenticate(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		log := m.logger.WithAPIKey(match.Key.Name)
+		if scope != "" && !match.Key.HasScope(scope) {
+			log.Warn("API key lacks required scope",
+				"path", r.URL.Path,
+				"method", r.Method,
+				"remote_addr", r.RemoteAddr,
+				"scope", scope,
+			)
+			m.sendErrorResponse(w, "ERR_FORBIDDEN", fmt.Sprintf("API key is not allowed to use this endpoint (requires scope %s)", scope), http.StatusForbidden)
+			return
+		}
+
+		// Expired or rotated secrets keep working during the grace period
+		if match.ValidUntil != nil {
+			log.Warn("Deprecated API key used, rotate it before the grace period ends",
+				"path", r.URL.Path,
+				"valid_until", match.ValidUntil.Format(time.RFC3339),
+			)
+			w.Header().Set("Warning", fmt.Sprintf(`299 - "API key is expired and stops working at %s"`, match.ValidUntil.Format(time.RFC3339)))
+		}
+
+		log.Info("API request",
+			"path", r.URL.Path,
+			"method", r.Method,
+			"remote_addr", r.RemoteAddr,
+		)
+
 		// API key is valid, proceed to next handler
-		next(w, r)
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, match.Key)))
 	}
 }
 
@@ -79,4 +137,3 @@ func (m *AuthMiddleware) sendErrorResponse(w http.ResponseWriter, code, message
 
 	json.NewEncoder(w).Encode(response)
 }
-
@@ -0,0 +1,245 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header names of a signed forward request
+const (
+	HeaderSignature = "X-Signature"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+)
+
+// signaturePrefix names the algorithm of the request signature
+const signaturePrefix = "sha256="
+
+// signedBodyReadTimeout is the read deadline of a signed request body, which may be a
+// media upload or a batch larger than the server read timeout allows
+const signedBodyReadTimeout = 2 * time.Minute
+
+// Accepted length of the X-Nonce header
+const (
+	minNonceLength = 16
+	maxNonceLength = 128
+)
+
+// SetForwardAllowlist restricts the forward API to clients in the allowed IPs or CIDRs.
+// X-Forwarded-For is only used when the request comes from a trusted proxy.
+func (m *AuthMiddleware) SetForwardAllowlist(allowed, trustedProxies []string) error {
+	allowedPrefixes, err := parsePrefixes(allowed)
+	if err != nil {
+		return fmt.Errorf("invalid FORWARD_ALLOWED_IPS: %w", err)
+	}
+	proxyPrefixes, err := parsePrefixes(trustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	m.allowedIPs = allowedPrefixes
+	m.trustedProxies = proxyPrefixes
+	return nil
+}
+
+// SetForwardSigning requires forward requests to be signed with the shared secret.
+// Requests older than tolerance or reusing a nonce are rejected, bodies larger
+// than maxBodySize are not read.
+func (m *AuthMiddleware) SetForwardSigning(secret string, tolerance time.Duration, maxBodySize int64) {
+	if secret == "" {
+		return
+	}
+	m.signingSecret = []byte(secret)
+	m.signatureTolerance = tolerance
+	m.maxSignedBody = maxBodySize
+	m.nonces = &nonceCache{seen: make(map[string]time.Time)}
+}
+
+// RestrictForward applies the IP allowlist and request signing of the forward API
+func (m *AuthMiddleware) RestrictForward(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientIP := m.clientIP(r)
+
+		if len(m.allowedIPs) > 0 && !containsAddr(m.allowedIPs, clientIP) {
+			m.logger.Warn("Forward request from IP not in allowlist",
+				"path", r.URL.Path,
+				"method", r.Method,
+				"remote_addr", r.RemoteAddr,
+				"client_ip", clientIP.String(),
+			)
+			m.sendErrorResponse(w, "ERR_FORBIDDEN", "IP address not allowed", http.StatusForbidden)
+			return
+		}
+
+		if m.signingSecret != nil {
+			if err := http.NewResponseController(w).SetReadDeadline(time.Now().Add(signedBodyReadTimeout)); err != nil {
+				m.logger.Debug("Failed to extend read deadline for signed body", "error", err)
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, m.maxSignedBody))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					m.sendErrorResponse(w, "ERR_INVALID_PARAMETER", "Request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				m.sendErrorResponse(w, "ERR_INVALID_PARAMETER", "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			if err := m.verifySignature(r, body, time.Now()); err != nil {
+				m.logger.Warn("Invalid forward request signature",
+					"path", r.URL.Path,
+					"method", r.Method,
+					"client_ip", clientIP.String(),
+					"error", err,
+				)
+				m.sendErrorResponse(w, "ERR_INVALID_SIGNATURE", "Invalid request signature: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// SignRequest returns the X-Signature value of a forward request:
+// "sha256=" + hex(HMAC-SHA256(secret, timestamp + "\n" + nonce + "\n" + method + "\n" + requestURI + "\n" + body))
+func SignRequest(secret []byte, timestamp, nonce, method, requestURI string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + nonce + "\n" + method + "\n" + requestURI + "\n"))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignature checks the signature, timestamp and nonce of a forward request
+func (m *AuthMiddleware) verifySignature(r *http.Request, body []byte, now time.Time) error {
+	timestamp := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	signature := r.Header.Get(HeaderSignature)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return fmt.Errorf("missing %s, %s or %s header", HeaderTimestamp, HeaderNonce, HeaderSignature)
+	}
+	if len(nonce) < minNonceLength || len(nonce) > maxNonceLength {
+		return fmt.Errorf("nonce must be %d-%d characters", minNonceLength, maxNonceLength)
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("timestamp must be unix seconds")
+	}
+	signedAt := time.Unix(unix, 0)
+	if skew := now.Sub(signedAt); skew > m.signatureTolerance || skew < -m.signatureTolerance {
+		return errors.New("timestamp outside tolerance")
+	}
+
+	expected := SignRequest(m.signingSecret, timestamp, nonce, r.Method, r.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("signature mismatch")
+	}
+
+	// Only remember nonces of valid signatures, so unsigned requests can't fill the cache
+	if !m.nonces.add(nonce, signedAt.Add(m.signatureTolerance), now) {
+		return errors.New("nonce already used")
+	}
+	return nil
+}
+
+// clientIP returns the IP of the client. Behind trusted proxies, X-Forwarded-For is
+// read from right to left and the first hop that is not a trusted proxy is the client.
+func (m *AuthMiddleware) clientIP(r *http.Request) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	addr := addrPort.Addr().Unmap()
+	if !containsAddr(m.trustedProxies, addr) {
+		return addr
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// Malformed hop, trust nothing further left
+			return addr
+		}
+		addr = hop.Unmap()
+		if !containsAddr(m.trustedProxies, addr) {
+			return addr
+		}
+	}
+	return addr
+}
+
+// containsAddr reports whether addr is in one of the prefixes
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefixes parses a list of IPs and CIDRs
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// nonceCache remembers the nonces of signed requests until their timestamp expires
+type nonceCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// add remembers a nonce until expiresAt. Returns false if the nonce was already used.
+func (c *nonceCache) add(nonce string, expiresAt, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if expiry, ok := c.seen[nonce]; ok && expiry.After(now) {
+		return false
+	}
+	for key, expiry := range c.seen {
+		if !expiry.After(now) {
+			delete(c.seen, key)
+		}
+	}
+	c.seen[nonce] = expiresAt
+	return true
+}
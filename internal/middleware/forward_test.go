@@ -0,0 +1,323 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+var (
+	testSecret = []byte("s3cret")
+	testNonce  = "0123456789abcdef"
+	testNow    = time.Unix(1760000000, 0)
+)
+
+// newTestMiddleware creates a middleware with the given forward allowlist and trusted proxies
+func newTestMiddleware(t *testing.T, allowed, trustedProxies []string) *AuthMiddleware {
+	t.Helper()
+	m := &AuthMiddleware{logger: logger.New("error")}
+	if err := m.SetForwardAllowlist(allowed, trustedProxies); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// signedRequest returns a forward request signed at signedAt
+func signedRequest(method, target, body, nonce string, signedAt time.Time) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	r.Header.Set(HeaderTimestamp, timestamp)
+	r.Header.Set(HeaderNonce, nonce)
+	r.Header.Set(HeaderSignature, SignRequest(testSecret, timestamp, nonce, method, r.URL.RequestURI(), []byte(body)))
+	return r
+}
+
+func TestSetForwardAllowlistInvalid(t *testing.T) {
+	m := &AuthMiddleware{logger: logger.New("error")}
+	if err := m.SetForwardAllowlist([]string{"10.0.0.0/33"}, nil); err == nil {
+		t.Error("invalid CIDR accepted in allowlist")
+	}
+	if err := m.SetForwardAllowlist(nil, []string{"proxy.local"}); err == nil {
+		t.Error("invalid address accepted in trusted proxies")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies := []string{"10.0.0.0/8"}
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		forwardedFor   []string
+		trustedProxies []string
+		want           string
+	}{
+		{"direct", "203.0.113.7:4000", nil, nil, "203.0.113.7"},
+		{"IPv4-mapped", "[::ffff:203.0.113.7]:4000", nil, nil, "203.0.113.7"},
+		{"X-Forwarded-For from untrusted peer", "203.0.113.7:4000", []string{"198.51.100.1"}, proxies, "203.0.113.7"},
+		{"X-Forwarded-For without trusted proxies", "10.0.0.2:4000", []string{"198.51.100.1"}, nil, "10.0.0.2"},
+		{"behind trusted proxy", "10.0.0.2:4000", []string{"198.51.100.1"}, proxies, "198.51.100.1"},
+		{"spoofed hop left of the client", "10.0.0.2:4000", []string{"192.0.2.9, 198.51.100.1"}, proxies, "198.51.100.1"},
+		{"proxy chain", "10.0.0.2:4000", []string{"198.51.100.1, 10.0.0.3"}, proxies, "198.51.100.1"},
+		{"multiple headers", "10.0.0.2:4000", []string{"198.51.100.1", "10.0.0.3"}, proxies, "198.51.100.1"},
+		{"malformed hop", "10.0.0.2:4000", []string{"198.51.100.1, bogus"}, proxies, "10.0.0.2"},
+		{"only trusted hops", "10.0.0.2:4000", []string{"10.0.0.3"}, proxies, "10.0.0.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMiddleware(t, nil, tt.trustedProxies)
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/forward", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := m.clientIP(r).String(); got != tt.want {
+				t.Errorf("clientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestrictForwardAllowlist(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowed      []string
+		remoteAddr   string
+		forwardedFor string
+		want         int
+	}{
+		{"no allowlist", nil, "203.0.113.7:4000", "", http.StatusOK},
+		{"allowed IP", []string{"203.0.113.7"}, "203.0.113.7:4000", "", http.StatusOK},
+		{"allowed CIDR", []string{"203.0.113.0/24"}, "203.0.113.7:4000", "", http.StatusOK},
+		{"allowed IPv6 CIDR", []string{"2001:db8::/32"}, "[2001:db8::7]:4000", "", http.StatusOK},
+		{"outside CIDR", []string{"203.0.113.0/24"}, "198.51.100.1:4000", "", http.StatusForbidden},
+		{"allowed client behind proxy", []string{"203.0.113.0/24"}, "10.0.0.2:4000", "203.0.113.7", http.StatusOK},
+		{"disallowed client behind proxy", []string{"10.0.0.0/8"}, "10.0.0.2:4000", "198.51.100.1", http.StatusForbidden},
+		{"spoofed X-Forwarded-For", []string{"203.0.113.0/24"}, "198.51.100.1:4000", "203.0.113.7", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMiddleware(t, tt.allowed, []string{"10.0.0.0/8"})
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/forward", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			w := httptest.NewRecorder()
+
+			m.RestrictForward(func(w http.ResponseWriter, r *http.Request) {})(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	const body = `{"trxid":"TRX1"}`
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			request: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/forward", body, testNonce, testNow)
+			},
+		},
+		{
+			name: "valid with query",
+			request: func() *http.Request {
+				return signedRequest(http.MethodGet, "/api/v1/forward?trxid=TRX1&tujuan=0812", "", testNonce, testNow)
+			},
+		},
+		{
+			name: "skew within tolerance",
+			request: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/forward", body, testNonce, testNow.Add(-4*time.Minute))
+			},
+		},
+		{
+			name: "expired",
+			request: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/forward", body, testNonce, testNow.Add(-6*time.Minute))
+			},
+			wantErr: true,
+		},
+		{
+			name: "from the future",
+			request: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/forward", body, testNonce, testNow.Add(6*time.Minute))
+			},
+			wantErr: true,
+		},
+		{
+			name: "tampered query",
+			request: func() *http.Request {
+				r := signedRequest(http.MethodGet, "/api/v1/forward?trxid=TRX1", "", testNonce, testNow)
+				r.URL.RawQuery = "trxid=TRX2"
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			name: "other method",
+			request: func() *http.Request {
+				r := signedRequest(http.MethodGet, "/api/v1/forward", body, testNonce, testNow)
+				r.Method = http.MethodPost
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			name: "wrong secret",
+			request: func() *http.Request {
+				r := signedRequest(http.MethodPost, "/api/v1/forward", body, testNonce, testNow)
+				r.Header.Set(HeaderSignature, SignRequest([]byte("other"), r.Header.Get(HeaderTimestamp), testNonce, http.MethodPost, "/api/v1/forward", []byte(body)))
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			name:    "nonce too short",
+			request: func() *http.Request { return signedRequest(http.MethodPost, "/api/v1/forward", body, "abc", testNow) },
+			wantErr: true,
+		},
+		{
+			name: "nonce too long",
+			request: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/forward", body, strings.Repeat("a", maxNonceLength+1), testNow)
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid timestamp",
+			request: func() *http.Request {
+				r := signedRequest(http.MethodPost, "/api/v1/forward", body, testNonce, testNow)
+				r.Header.Set(HeaderTimestamp, "yesterday")
+				return r
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing signature",
+			request: func() *http.Request {
+				r := signedRequest(http.MethodPost, "/api/v1/forward", body, testNonce, testNow)
+				r.Header.Del(HeaderSignature)
+				return r
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMiddleware(t, nil, nil)
+			m.SetForwardSigning(string(testSecret), 5*time.Minute, 1<<20)
+
+			r := tt.request()
+			data, _ := io.ReadAll(r.Body)
+			err := m.verifySignature(r, data, testNow)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifySignature() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureNonce(t *testing.T) {
+	tests := []struct {
+		name    string
+		nonce   string
+		later   time.Duration
+		wantErr bool
+	}{
+		{"nonce reused", testNonce, time.Second, true},
+		{"other nonce", "fedcba9876543210", time.Second, false},
+		{"nonce reused after its timestamp expired", testNonce, 6 * time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMiddleware(t, nil, nil)
+			m.SetForwardSigning(string(testSecret), 5*time.Minute, 1<<20)
+
+			if err := m.verifySignature(signedRequest(http.MethodGet, "/api/v1/forward", "", testNonce, testNow), nil, testNow); err != nil {
+				t.Fatalf("first request rejected: %v", err)
+			}
+			now := testNow.Add(tt.later)
+			err := m.verifySignature(signedRequest(http.MethodGet, "/api/v1/forward", "", tt.nonce, now), nil, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("second request error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRestrictForwardSigning(t *testing.T) {
+	const body = `{"trxid":"TRX1"}`
+
+	tests := []struct {
+		name        string
+		request     func() *http.Request
+		maxBodySize int64
+		want        int
+	}{
+		{
+			name: "signed",
+			request: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/forward", body, testNonce, time.Now())
+			},
+			maxBodySize: 1 << 20,
+			want:        http.StatusOK,
+		},
+		{
+			name: "unsigned",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/api/v1/forward", strings.NewReader(body))
+			},
+			maxBodySize: 1 << 20,
+			want:        http.StatusUnauthorized,
+		},
+		{
+			name: "body too large",
+			request: func() *http.Request {
+				return signedRequest(http.MethodPost, "/api/v1/forward", body, testNonce, time.Now())
+			},
+			maxBodySize: 4,
+			want:        http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMiddleware(t, nil, nil)
+			m.SetForwardSigning(string(testSecret), 5*time.Minute, tt.maxBodySize)
+
+			var received string
+			w := httptest.NewRecorder()
+			m.RestrictForward(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				received = string(data)
+			})(w, tt.request())
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			// The handler still reads the body that was verified
+			if tt.want == http.StatusOK && received != body {
+				t.Errorf("handler read body %q, want %q", received, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// API key scopes
+const (
+	ScopeForward = "forward" // Forward transaksi, status transaksi, render template, download media
+	ScopeGroups  = "groups"  // List group WhatsApp
+	ScopeAdmin   = "admin"   // All endpoints, including sessions, webhook deliveries and API keys
+)
+
+// Scopes lists all API key scopes
+var Scopes = []string{ScopeForward, ScopeGroups, ScopeAdmin}
+
+// APIKey represents a named API key, without its secret
+type APIKey struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	Source    string     `json:"source"` // "env", "file" or "sqlite"
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+
+	// PreviousExpiresAt is when the secret replaced by the last rotation stops working
+	PreviousExpiresAt *time.Time `json:"previous_expires_at,omitempty"`
+}
+
+// HasScope reports whether the key grants the scope; admin keys grant every scope
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, ScopeAdmin) || slices.Contains(k.Scopes, scope)
+}
+
+// APIKeySecret is returned once when an API key is created or rotated
+type APIKeySecret struct {
+	*APIKey
+	Key string `json:"key"`
+}
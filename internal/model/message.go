@@ -19,6 +19,7 @@ type IncomingMessage struct {
 // WebhookPayload represents payload sent to Otomax webhook
 type WebhookPayload struct {
 	Event   string         `json:"event"`
+	Device  string         `json:"device"` // WhatsApp number (device) that received the message
 	Sender  Sender         `json:"sender"`
 	Message MessageContent `json:"message"`
 	Context MessageContext `json:"context"`
@@ -36,16 +37,77 @@ type MessageContent struct {
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
 	MediaURL  string    `json:"media_url,omitempty"`
+	Caption   string    `json:"caption,omitempty"`
+	MimeType  string    `json:"mimetype,omitempty"`
+	FileName  string    `json:"file_name,omitempty"`
+	FileSize  int64     `json:"file_size,omitempty"`
 }
 
 // MessageContext represents message context
 type MessageContext struct {
 	ChatType             string `json:"chat_type"`
 	IsReply              bool   `json:"is_reply"`
+	TrxID                string `json:"trxid"`
+	MatchStrategy        string `json:"match_strategy"`                   // How the reply was matched to the transaction
 	OriginalMessageID    string `json:"original_message_id,omitempty"`
 	QuotedMessageContent string `json:"quoted_message_content,omitempty"` // Content dari message yang di-reply
 }
 
+// Match strategies used to correlate an incoming message to a transaction
+const (
+	// MatchStrategyQuotedMessage means the reply quoted the transaction message
+	MatchStrategyQuotedMessage = "quoted_message"
+	// MatchStrategyLatestInChat means the message was not a reply and was
+	// attributed to the latest tracked transaction in the chat
+	MatchStrategyLatestInChat = "latest_in_chat"
+	// MatchStrategyLatestInChatUntrackedQuote means the reply quoted a message that is not a
+	// tracked transaction (e.g. the supplier's own message) and was attributed to the latest
+	// tracked transaction in the chat
+	MatchStrategyLatestInChatUntrackedQuote = "latest_in_chat_untracked_quote"
+)
+
+// TransactionStatusPayload represents a transaction status update sent to Otomax webhook
+type TransactionStatusPayload struct {
+	Event       string    `json:"event"` // "transaction_status"
+	TrxID       string    `json:"trxid"`
+	Status      string    `json:"status"` // "sent" or "failed"
+	Destination string    `json:"destination"`
+	Sender      string    `json:"sender,omitempty"` // Sender WhatsApp number (device)
+	MessageID   string    `json:"message_id,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// MessageStatusPayload represents a delivery/read receipt of a transaction message sent to Otomax webhook
+type MessageStatusPayload struct {
+	Event       string    `json:"event"` // "message_status"
+	TrxID       string    `json:"trxid"`
+	MessageID   string    `json:"message_id"`
+	Status      string    `json:"status"` // "delivered" or "read"
+	Destination string    `json:"destination"`
+	Device      string    `json:"device"`    // WhatsApp number (device) that sent the transaction message
+	Recipient   string    `json:"recipient"` // Number that sent the receipt (the participant for groups)
+	SentAt      time.Time `json:"sent_at"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Message statuses reported in message_status events
+const (
+	MessageStatusDelivered = "delivered"
+	MessageStatusRead      = "read"
+)
+
+// SessionStatusPayload represents an alert about the WhatsApp session of a device sent to Otomax webhook
+type SessionStatusPayload struct {
+	Event             string     `json:"event"`  // "session_status"
+	Device            string     `json:"device"` // WhatsApp number (device)
+	Status            string     `json:"status"` // "logged_out", "banned", "stream_replaced" or "client_outdated"
+	Reason            string     `json:"reason,omitempty"`
+	DisconnectedSince *time.Time `json:"disconnected_since,omitempty"`
+	ReconnectAt       *time.Time `json:"reconnect_at,omitempty"` // Untuk banned: perkiraan akhir ban
+	Timestamp         time.Time  `json:"timestamp"`
+}
+
 // WebhookResponse represents response from Otomax webhook
 type WebhookResponse struct {
 	Status  string `json:"status"`
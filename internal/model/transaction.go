@@ -8,8 +8,34 @@ type TransactionRequest struct {
 	TrxID        string `json:"trxid"`
 	Descriptions string `json:"descriptions"`
 	Instructions string `json:"instructions"`
+	Product      string `json:"product,omitempty"`    // Product code selecting the message template
+	Sender       string `json:"sender,omitempty"`     // Sender WhatsApp number (device), defaults to the routing rules
+	Async        bool   `json:"async"`                // Store in the queue and send in the background
+	MediaURL     string `json:"media_url,omitempty"`  // URL of media downloaded and sent as an attachment
+	MediaType    string `json:"media_type,omitempty"` // "image" or "document" (default: from the mimetype)
+
+	// Media is the attachment uploaded with the request (or fetched from MediaURL)
+	Media *TransactionMedia `json:"-"`
+
+	// APIKey is the name of the API key that made the request
+	APIKey string `json:"-"`
 }
 
+// TransactionMedia represents an image or document sent with a transaction;
+// the instructions are used as caption
+type TransactionMedia struct {
+	Type     string // "image" or "document"
+	FileName string
+	MimeType string
+	Data     []byte
+}
+
+// Media types that can be sent with a transaction
+const (
+	MediaTypeImage    = "image"
+	MediaTypeDocument = "document"
+)
+
 // TransactionResponse represents response for transaction forwarding
 type TransactionResponse struct {
 	Status  string              `json:"status"`
@@ -20,17 +46,94 @@ type TransactionResponse struct {
 
 // TransactionData represents successful transaction data
 type TransactionData struct {
-	TrxID           string    `json:"trxid"`
-	Destination     string    `json:"destination"`
-	DestinationType string    `json:"destination_type"`
-	MessageID       string    `json:"message_id"`
-	Timestamp       time.Time `json:"timestamp"`
+	TrxID            string    `json:"trxid"`
+	Destination      string    `json:"destination"`
+	DestinationType  string    `json:"destination_type"`
+	Sender           string    `json:"sender,omitempty"` // Sender WhatsApp number (device)
+	MessageID        string    `json:"message_id"`
+	Timestamp        time.Time `json:"timestamp"`
+	Status           string    `json:"status"`                      // "sent" or "pending" (async)
+	Delivery         string    `json:"delivery"`                    // "immediate", "queued" (rate limited) or "async"
+	QueuePosition    int       `json:"queue_position,omitempty"`    // Position in the queue when queued
+	MediaType        string    `json:"media_type,omitempty"`        // "image" or "document" if there is an attachment
+	IdempotentReplay bool      `json:"idempotent_replay,omitempty"` // true if the TrxID was already sent, data is the original result
 }
 
 // TransactionError represents error response
 type TransactionError struct {
-	Code    string `json:"error_code"`
-	Message string `json:"message"`
+	Code    string       `json:"error_code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"` // Per-field errors if the request is invalid
+}
+
+// BatchResponse represents response for batch transaction forwarding
+type BatchResponse struct {
+	Status  string            `json:"status"`
+	Message string            `json:"message"`
+	Data    *BatchData        `json:"data,omitempty"`
+	Error   *TransactionError `json:"error,omitempty"`
+}
+
+// BatchData represents the results of a batch, in the order of the request
+type BatchData struct {
+	Total     int               `json:"total"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+// BatchItemResult represents the result of one transaction of a batch
+type BatchItemResult struct {
+	Index  int               `json:"index"` // Posisi transaksi di array request
+	TrxID  string            `json:"trxid,omitempty"`
+	Status string            `json:"status"` // "success" or "error"
+	Data   *TransactionData  `json:"data,omitempty"`
+	Error  *TransactionError `json:"error,omitempty"`
+}
+
+// TransactionDetail represents the tracked state of a transaction
+type TransactionDetail struct {
+	TrxID           string             `json:"trxid"`
+	MessageID       string             `json:"message_id,omitempty"`
+	Destination     string             `json:"destination"`
+	DestinationType string             `json:"destination_type,omitempty"`
+	Sender          string             `json:"sender,omitempty"`
+	APIKey          string             `json:"api_key,omitempty"` // Name of the API key that forwarded the transaction
+	Status          string             `json:"status,omitempty"`  // pending, sent, delivered, read, replied, failed or expired
+	SentAt          *time.Time         `json:"sent_at,omitempty"`
+	ExpiresAt       *time.Time         `json:"expires_at,omitempty"`
+	DeliveredAt     *time.Time         `json:"delivered_at,omitempty"`
+	ReadAt          *time.Time         `json:"read_at,omitempty"`
+	RepliedAt       *time.Time         `json:"replied_at,omitempty"`
+	Expired         bool               `json:"expired"`
+	Delivery        DeliveryState      `json:"delivery"`
+	Replies         []TransactionReply `json:"replies"`
+}
+
+// DeliveryState represents the WhatsApp delivery state of a transaction
+type DeliveryState struct {
+	Status    string     `json:"status"` // "pending", "sending", "sent" or "failed"
+	Mode      string     `json:"mode"`   // "sync" or "async"
+	Attempts  int        `json:"attempts,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	QueuedAt  *time.Time `json:"queued_at,omitempty"`
+}
+
+// TransactionReply represents a reply received for a transaction
+type TransactionReply struct {
+	Sender        Sender         `json:"sender"`
+	Message       MessageContent `json:"message"`
+	Context       MessageContext `json:"context"`
+	WebhookStatus string         `json:"webhook_status"` // Delivery status of the Otomax webhook
+	WebhookID     int64          `json:"webhook_delivery_id"`
+}
+
+// TransactionDetailResponse represents response for transaction lookup
+type TransactionDetailResponse struct {
+	Status  string             `json:"status"`
+	Message string             `json:"message"`
+	Data    *TransactionDetail `json:"data,omitempty"`
+	Error   *TransactionError  `json:"error,omitempty"`
 }
 
 // TrackingInfo holds message tracking information
@@ -0,0 +1,102 @@
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Maximum length of the transaction request fields, in characters (runes)
+const (
+	MaxTrxIDLength        = 100
+	MaxDestinationLength  = 64
+	MaxDescriptionsLength = 4096
+	MaxInstructionsLength = 4096
+	MaxProductLength      = 64
+	MaxSenderLength       = 32
+	MaxMediaURLLength     = 2048
+)
+
+// Field error reasons
+const (
+	FieldErrorRequired = "required"
+	FieldErrorTooLong  = "too_long"
+	FieldErrorInvalid  = "invalid"
+	FieldErrorUnknown  = "unknown"
+)
+
+// FieldError describes why a single request field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Reason  string `json:"reason"` // required, too_long, invalid or unknown
+	Message string `json:"message"`
+}
+
+// HasRequiredFieldError reports whether any of the errors is a missing required field
+func HasRequiredFieldError(errs []FieldError) bool {
+	for _, fieldErr := range errs {
+		if fieldErr.Reason == FieldErrorRequired {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the fields of a transaction request and returns an error for
+// every invalid field. Lengths are counted in characters, not bytes.
+func (r *TransactionRequest) Validate() []FieldError {
+	var errs []FieldError
+
+	// Single line fields
+	errs = validateText(errs, "trxid", r.TrxID, true, false, MaxTrxIDLength)
+	errs = validateText(errs, "destination", r.Destination, true, false, MaxDestinationLength)
+	errs = validateText(errs, "product", r.Product, false, false, MaxProductLength)
+	errs = validateText(errs, "sender", r.Sender, false, false, MaxSenderLength)
+
+	// Message text, may span multiple lines
+	errs = validateText(errs, "descriptions", r.Descriptions, true, true, MaxDescriptionsLength)
+	errs = validateText(errs, "instructions", r.Instructions, true, true, MaxInstructionsLength)
+
+	if r.MediaURL != "" {
+		errs = validateText(errs, "media_url", r.MediaURL, false, false, MaxMediaURLLength)
+		if parsed, err := url.Parse(r.MediaURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			errs = append(errs, FieldError{Field: "media_url", Reason: FieldErrorInvalid, Message: "media_url must be an absolute http or https URL"})
+		}
+	}
+	if r.MediaType != "" {
+		switch {
+		case r.MediaType != MediaTypeImage && r.MediaType != MediaTypeDocument:
+			errs = append(errs, FieldError{Field: "media_type", Reason: FieldErrorInvalid, Message: fmt.Sprintf("media_type must be %s or %s", MediaTypeImage, MediaTypeDocument)})
+		case r.MediaURL == "" && r.Media == nil:
+			errs = append(errs, FieldError{Field: "media_type", Reason: FieldErrorInvalid, Message: "media_type requires file or media_url"})
+		}
+	}
+
+	return errs
+}
+
+// validateText checks presence, encoding and length of a text field
+func validateText(errs []FieldError, field, value string, required, multiline bool, maxLength int) []FieldError {
+	if strings.TrimSpace(value) == "" {
+		if required {
+			return append(errs, FieldError{Field: field, Reason: FieldErrorRequired, Message: field + " is required"})
+		}
+		if value == "" {
+			return errs
+		}
+	}
+	if !utf8.ValidString(value) {
+		return append(errs, FieldError{Field: field, Reason: FieldErrorInvalid, Message: field + " must be valid UTF-8 text"})
+	}
+	if length := utf8.RuneCountInString(value); length > maxLength {
+		return append(errs, FieldError{Field: field, Reason: FieldErrorTooLong, Message: fmt.Sprintf("%s is too long (%d characters, max %d)", field, length, maxLength)})
+	}
+	for _, c := range value {
+		if unicode.IsControl(c) && !(multiline && (c == '\n' || c == '\r' || c == '\t')) {
+			return append(errs, FieldError{Field: field, Reason: FieldErrorInvalid, Message: field + " contains control characters"})
+		}
+	}
+	return errs
+}
@@ -0,0 +1,176 @@
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// validRequest returns a transaction request that passes validation
+func validRequest() TransactionRequest {
+	return TransactionRequest{
+		TrxID:        "TRX1",
+		Destination:  "081234567890",
+		Descriptions: "Pesanan baru",
+		Instructions: "Mohon diproses",
+	}
+}
+
+func TestTransactionRequestValidate(t *testing.T) {
+	type fieldReason struct{ field, reason string }
+
+	tests := []struct {
+		name   string
+		modify func(r *TransactionRequest)
+		want   []fieldReason
+	}{
+		{
+			name:   "valid",
+			modify: func(r *TransactionRequest) {},
+		},
+		{
+			name: "valid with optional fields",
+			modify: func(r *TransactionRequest) {
+				r.Product = "PULSA10"
+				r.Sender = "628111"
+				r.MediaURL = "https://cdn.example.com/struk.png"
+				r.MediaType = MediaTypeImage
+			},
+		},
+		{
+			name:   "multiline message",
+			modify: func(r *TransactionRequest) { r.Instructions = "Baris 1\r\nBaris 2\n\tBaris 3" },
+		},
+		{
+			name:   "all required missing",
+			modify: func(r *TransactionRequest) { *r = TransactionRequest{} },
+			want: []fieldReason{
+				{"trxid", FieldErrorRequired},
+				{"destination", FieldErrorRequired},
+				{"descriptions", FieldErrorRequired},
+				{"instructions", FieldErrorRequired},
+			},
+		},
+		{
+			name:   "whitespace only",
+			modify: func(r *TransactionRequest) { r.TrxID = " \t " },
+			want:   []fieldReason{{"trxid", FieldErrorRequired}},
+		},
+		{
+			name:   "trxid at max length",
+			modify: func(r *TransactionRequest) { r.TrxID = strings.Repeat("x", MaxTrxIDLength) },
+		},
+		{
+			name:   "trxid too long",
+			modify: func(r *TransactionRequest) { r.TrxID = strings.Repeat("x", MaxTrxIDLength+1) },
+			want:   []fieldReason{{"trxid", FieldErrorTooLong}},
+		},
+		{
+			name:   "length counted in characters",
+			modify: func(r *TransactionRequest) { r.Descriptions = strings.Repeat("é", MaxDescriptionsLength) },
+		},
+		{
+			name:   "instructions too long",
+			modify: func(r *TransactionRequest) { r.Instructions = strings.Repeat("é", MaxInstructionsLength+1) },
+			want:   []fieldReason{{"instructions", FieldErrorTooLong}},
+		},
+		{
+			name: "optional fields too long",
+			modify: func(r *TransactionRequest) {
+				r.Product = strings.Repeat("P", MaxProductLength+1)
+				r.Sender = strings.Repeat("6", MaxSenderLength+1)
+			},
+			want: []fieldReason{{"product", FieldErrorTooLong}, {"sender", FieldErrorTooLong}},
+		},
+		{
+			name:   "invalid UTF-8",
+			modify: func(r *TransactionRequest) { r.Destination = "0812\xff" },
+			want:   []fieldReason{{"destination", FieldErrorInvalid}},
+		},
+		{
+			name:   "newline in single line field",
+			modify: func(r *TransactionRequest) { r.TrxID = "TRX1\nTRX2" },
+			want:   []fieldReason{{"trxid", FieldErrorInvalid}},
+		},
+		{
+			name:   "control character in message",
+			modify: func(r *TransactionRequest) { r.Descriptions = "Pesanan\x00baru" },
+			want:   []fieldReason{{"descriptions", FieldErrorInvalid}},
+		},
+		{
+			name:   "relative media_url",
+			modify: func(r *TransactionRequest) { r.MediaURL = "/struk.png" },
+			want:   []fieldReason{{"media_url", FieldErrorInvalid}},
+		},
+		{
+			name:   "media_url with other scheme",
+			modify: func(r *TransactionRequest) { r.MediaURL = "file:///etc/passwd" },
+			want:   []fieldReason{{"media_url", FieldErrorInvalid}},
+		},
+		{
+			name: "media_url too long",
+			modify: func(r *TransactionRequest) {
+				r.MediaURL = "https://cdn.example.com/" + strings.Repeat("a", MaxMediaURLLength)
+			},
+			want: []fieldReason{{"media_url", FieldErrorTooLong}},
+		},
+		{
+			name: "unknown media_type",
+			modify: func(r *TransactionRequest) {
+				r.MediaURL = "https://cdn.example.com/struk.png"
+				r.MediaType = "video"
+			},
+			want: []fieldReason{{"media_type", FieldErrorInvalid}},
+		},
+		{
+			name:   "media_type without media",
+			modify: func(r *TransactionRequest) { r.MediaType = MediaTypeDocument },
+			want:   []fieldReason{{"media_type", FieldErrorInvalid}},
+		},
+		{
+			name: "media_type with uploaded file",
+			modify: func(r *TransactionRequest) {
+				r.MediaType = MediaTypeDocument
+				r.Media = &TransactionMedia{}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validRequest()
+			tt.modify(&req)
+
+			var got []fieldReason
+			for _, fieldErr := range req.Validate() {
+				if fieldErr.Message == "" {
+					t.Errorf("%s error without message", fieldErr.Field)
+				}
+				got = append(got, fieldReason{fieldErr.Field, fieldErr.Reason})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasRequiredFieldError(t *testing.T) {
+	tests := []struct {
+		name string
+		errs []FieldError
+		want bool
+	}{
+		{"no errors", nil, false},
+		{"too long only", []FieldError{{Field: "trxid", Reason: FieldErrorTooLong}}, false},
+		{"required among others", []FieldError{{Field: "sender", Reason: FieldErrorInvalid}, {Field: "trxid", Reason: FieldErrorRequired}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasRequiredFieldError(tt.errs); got != tt.want {
+				t.Errorf("HasRequiredFieldError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
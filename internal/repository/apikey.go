@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// APIKeyRecord represents an API key stored in the tracking database.
+// Only the SHA-256 hash of the secret is stored.
+type APIKeyRecord struct {
+	Name              string
+	KeyHash           string
+	Scopes            []string
+	ExpiresAt         *time.Time
+	PreviousKeyHash   string     // Secret replaced by the last rotation
+	PreviousExpiresAt *time.Time // End of the grace period of the previous secret
+	CreatedAt         time.Time
+	RotatedAt         *time.Time
+}
+
+// apiKeyColumns is the column list scanned by scanAPIKey
+const apiKeyColumns = `name, key_hash, scopes, expires_at, previous_key_hash, previous_expires_at, created_at, rotated_at`
+
+// APIKeyRepository handles database operations for API keys
+type APIKeyRepository struct {
+	db *sql.DB
+}
+
+// NewAPIKeyRepository creates a new API key repository on an open tracking database
+func NewAPIKeyRepository(db *sql.DB) (*APIKeyRepository, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_keys (
+			name TEXT PRIMARY KEY,
+			key_hash TEXT NOT NULL UNIQUE,
+			scopes TEXT NOT NULL,
+			expires_at DATETIME,
+			previous_key_hash TEXT NOT NULL DEFAULT '',
+			previous_expires_at DATETIME,
+			created_at DATETIME NOT NULL,
+			rotated_at DATETIME
+		);
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &APIKeyRepository{db: db}, nil
+}
+
+// Create saves a new API key. Returns false if the name is already taken.
+func (r *APIKeyRepository) Create(record *APIKeyRecord) (bool, error) {
+	record.CreatedAt = time.Now()
+	result, err := r.db.Exec(`
+		INSERT INTO api_keys (name, key_hash, scopes, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO NOTHING
+	`, record.Name, record.KeyHash, strings.Join(record.Scopes, ","), record.ExpiresAt, record.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// List returns all API keys ordered by name
+func (r *APIKeyRepository) List() ([]*APIKeyRecord, error) {
+	rows, err := r.db.Query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]*APIKeyRecord, 0)
+	for rows.Next() {
+		record, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// Get returns an API key by name, or nil if not found
+func (r *APIKeyRepository) Get(name string) (*APIKeyRecord, error) {
+	record, err := scanAPIKey(r.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE name = ?`, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return record, err
+}
+
+// Rotate replaces the secret of an API key. The current secret keeps working
+// until previousExpiresAt. Returns false if the key doesn't exist.
+func (r *APIKeyRepository) Rotate(name, keyHash string, previousExpiresAt time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE api_keys
+		SET previous_key_hash = key_hash, previous_expires_at = ?, key_hash = ?, rotated_at = ?
+		WHERE name = ?
+	`, previousExpiresAt, keyHash, time.Now(), name)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// Delete removes an API key, revoking its current and previous secret
+func (r *APIKeyRepository) Delete(name string) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM api_keys WHERE name = ?`, name)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row rowScanner) (*APIKeyRecord, error) {
+	var record APIKeyRecord
+	var scopes string
+	var expiresAt, previousExpiresAt, rotatedAt sql.NullTime
+	err := row.Scan(
+		&record.Name,
+		&record.KeyHash,
+		&scopes,
+		&expiresAt,
+		&record.PreviousKeyHash,
+		&previousExpiresAt,
+		&record.CreatedAt,
+		&rotatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if scopes != "" {
+		record.Scopes = strings.Split(scopes, ",")
+	}
+	if expiresAt.Valid {
+		record.ExpiresAt = &expiresAt.Time
+	}
+	if previousExpiresAt.Valid {
+		record.PreviousExpiresAt = &previousExpiresAt.Time
+	}
+	if rotatedAt.Valid {
+		record.RotatedAt = &rotatedAt.Time
+	}
+	return &record, nil
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MediaRecord represents a media file downloaded from WhatsApp
+type MediaRecord struct {
+	ID        string    `json:"id"`
+	MessageID string    `json:"message_id"`
+	ChatJID   string    `json:"chat_jid"`
+	TrxID     string    `json:"trx_id"`
+	MediaType string    `json:"media_type"`
+	MimeType  string    `json:"mimetype"`
+	FileName  string    `json:"file_name"`
+	FileSize  int64     `json:"file_size"`
+	Path      string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MediaRepository handles database operations for stored media
+type MediaRepository struct {
+	db *sql.DB
+}
+
+// NewMediaRepository creates a new media repository on an open tracking database
+func NewMediaRepository(db *sql.DB) (*MediaRepository, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS media (
+			id TEXT PRIMARY KEY,
+			message_id TEXT NOT NULL,
+			chat_jid TEXT NOT NULL,
+			trx_id TEXT NOT NULL,
+			media_type TEXT NOT NULL,
+			mimetype TEXT NOT NULL,
+			file_name TEXT NOT NULL,
+			file_size INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_media_expires_at ON media(expires_at);
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MediaRepository{db: db}, nil
+}
+
+// Save saves a media record
+func (r *MediaRepository) Save(record *MediaRecord) error {
+	_, err := r.db.Exec(`
+		INSERT INTO media (id, message_id, chat_jid, trx_id, media_type, mimetype, file_name, file_size, path, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, record.ID, record.MessageID, record.ChatJID, record.TrxID, record.MediaType, record.MimeType,
+		record.FileName, record.FileSize, record.Path, record.CreatedAt, record.ExpiresAt)
+	return err
+}
+
+// GetByID gets a media record by ID (only non-expired)
+func (r *MediaRepository) GetByID(id string) (*MediaRecord, error) {
+	var record MediaRecord
+	err := r.db.QueryRow(`
+		SELECT id, message_id, chat_jid, trx_id, media_type, mimetype, file_name, file_size, path, created_at, expires_at
+		FROM media
+		WHERE id = ? AND expires_at > ?
+	`, id, time.Now()).Scan(
+		&record.ID,
+		&record.MessageID,
+		&record.ChatJID,
+		&record.TrxID,
+		&record.MediaType,
+		&record.MimeType,
+		&record.FileName,
+		&record.FileSize,
+		&record.Path,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ListExpiredPaths returns the file paths of expired media records
+func (r *MediaRepository) ListExpiredPaths() (map[string]string, error) {
+	rows, err := r.db.Query(`
+		SELECT id, path FROM media WHERE expires_at <= ?
+	`, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := make(map[string]string)
+	for rows.Next() {
+		var id, path string
+		if err := rows.Scan(&id, &path); err != nil {
+			return nil, err
+		}
+		paths[id] = path
+	}
+	return paths, rows.Err()
+}
+
+// Delete removes a media record
+func (r *MediaRepository) Delete(id string) error {
+	_, err := r.db.Exec(`DELETE FROM media WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Message directions
+const (
+	MessageDirectionIncoming = "incoming"
+	MessageDirectionOutgoing = "outgoing"
+)
+
+// Webhook statuses of a logged message that has no outbox delivery
+const (
+	MessageWebhookNone   = "none"   // Outgoing message, nothing is forwarded
+	MessageWebhookFailed = "failed" // The payload could not be queued in the outbox
+)
+
+// MessageRecord represents a message sent or received for a transaction
+type MessageRecord struct {
+	ID                int64     `json:"id"`
+	Direction         string    `json:"direction"`
+	MessageID         string    `json:"message_id"`
+	ChatJID           string    `json:"chat_jid"`
+	Sender            string    `json:"sender"`
+	Device            string    `json:"device"`
+	Type              string    `json:"type"`
+	Content           string    `json:"content"`
+	MediaURL          string    `json:"media_url,omitempty"`
+	QuotedID          string    `json:"quoted_message_id,omitempty"`
+	TrxID             string    `json:"trxid"`
+	WebhookStatus     string    `json:"webhook_status"`
+	WebhookDeliveryID int64     `json:"webhook_delivery_id,omitempty"`
+	Timestamp         time.Time `json:"timestamp"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// MessageRepository handles database operations for the message log of transactions
+type MessageRepository struct {
+	db *sql.DB
+}
+
+// NewMessageRepository creates a new message log repository on an open tracking database
+func NewMessageRepository(db *sql.DB) (*MessageRepository, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS messages (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			direction TEXT NOT NULL,
+			message_id TEXT NOT NULL,
+			chat_jid TEXT NOT NULL,
+			sender TEXT NOT NULL,
+			device TEXT NOT NULL,
+			type TEXT NOT NULL,
+			content TEXT NOT NULL DEFAULT '',
+			media_url TEXT NOT NULL DEFAULT '',
+			quoted_id TEXT NOT NULL DEFAULT '',
+			trx_id TEXT NOT NULL,
+			webhook_status TEXT NOT NULL,
+			webhook_delivery_id INTEGER NOT NULL DEFAULT 0,
+			timestamp DATETIME NOT NULL,
+			created_at DATETIME NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_messages_trx_id ON messages(trx_id, timestamp);
+		CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages(created_at);
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MessageRepository{db: db}, nil
+}
+
+// Save saves a message record
+func (r *MessageRepository) Save(record *MessageRecord) error {
+	record.CreatedAt = time.Now()
+	result, err := r.db.Exec(`
+		INSERT INTO messages (direction, message_id, chat_jid, sender, device, type, content, media_url, quoted_id, trx_id, webhook_status, webhook_delivery_id, timestamp, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, record.Direction, record.MessageID, record.ChatJID, record.Sender, record.Device, record.Type, record.Content,
+		record.MediaURL, record.QuotedID, record.TrxID, record.WebhookStatus, record.WebhookDeliveryID, record.Timestamp, record.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	record.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// ListByTrxID returns the messages of a transaction, oldest first.
+// The webhook status of incoming messages is the current status of their outbox delivery.
+func (r *MessageRepository) ListByTrxID(trxID string) ([]*MessageRecord, error) {
+	rows, err := r.db.Query(`
+		SELECT m.id, m.direction, m.message_id, m.chat_jid, m.sender, m.device, m.type, m.content, m.media_url, m.quoted_id,
+			m.trx_id, COALESCE(d.status, m.webhook_status), m.webhook_delivery_id, m.timestamp, m.created_at
+		FROM messages m
+		LEFT JOIN webhook_deliveries d ON d.id = m.webhook_delivery_id
+		WHERE m.trx_id = ?
+		ORDER BY m.timestamp ASC, m.id ASC
+	`, trxID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := make([]*MessageRecord, 0)
+	for rows.Next() {
+		var record MessageRecord
+		if err := rows.Scan(
+			&record.ID,
+			&record.Direction,
+			&record.MessageID,
+			&record.ChatJID,
+			&record.Sender,
+			&record.Device,
+			&record.Type,
+			&record.Content,
+			&record.MediaURL,
+			&record.QuotedID,
+			&record.TrxID,
+			&record.WebhookStatus,
+			&record.WebhookDeliveryID,
+			&record.Timestamp,
+			&record.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		records = append(records, &record)
+	}
+	return records, rows.Err()
+}
+
+// PurgeBefore deletes messages logged before the given time
+func (r *MessageRepository) PurgeBefore(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM messages WHERE created_at <= ?
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Outbound queue statuses
+const (
+	OutboundStatusPending = "pending"
+	OutboundStatusSending = "sending"
+	OutboundStatusSent    = "sent"
+	OutboundStatusFailed  = "failed"
+)
+
+// OutboundRecord represents a queued outbound message in database
+type OutboundRecord struct {
+	ID          int64     `json:"id"`
+	TrxID       string    `json:"trx_id"`
+	Destination string    `json:"destination"`
+	Sender      string    `json:"sender,omitempty"`
+	Message     string    `json:"message"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	MessageID   string    `json:"message_id,omitempty"`
+	ContentHash string    `json:"content_hash,omitempty"` // Hash of the request content, to detect retries
+	APIKey      string    `json:"api_key,omitempty"`      // Name of the API key that queued the transaction
+	Product     string    `json:"product,omitempty"`      // Product code used to route the transaction to a sender
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// outboundColumns is the column list scanned by scanOutbound
+const outboundColumns = `id, trx_id, destination, sender, message, status, attempts, last_error, message_id, content_hash, api_key, product, created_at, updated_at`
+
+// OutboundRepository handles database operations for the outbound queue
+type OutboundRepository struct {
+	db *sql.DB
+}
+
+// NewOutboundRepository creates a new outbound queue repository on an open tracking database
+func NewOutboundRepository(db *sql.DB) (*OutboundRepository, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS outbound_queue (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			trx_id TEXT NOT NULL UNIQUE,
+			destination TEXT NOT NULL,
+			message TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			message_id TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_outbound_status ON outbound_queue(status);
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Columns added after the first release
+	for _, column := range []struct{ name, definition string }{
+		{"sender", "TEXT NOT NULL DEFAULT ''"},
+		{"content_hash", "TEXT NOT NULL DEFAULT ''"},
+		{"api_key", "TEXT NOT NULL DEFAULT ''"},
+		{"product", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		if err := addColumnIfMissing(db, "outbound_queue", column.name, column.definition); err != nil {
+			return nil, err
+		}
+	}
+
+	return &OutboundRepository{db: db}, nil
+}
+
+// Enqueue saves a new pending outbound message. A previous failed or sent entry
+// for the same TrxID is replaced; returns false if the TrxID is still queued.
+func (r *OutboundRepository) Enqueue(record *OutboundRecord) (bool, error) {
+	now := time.Now()
+	result, err := r.db.Exec(`
+		INSERT INTO outbound_queue (trx_id, destination, sender, message, content_hash, api_key, product, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(trx_id) DO UPDATE SET
+			destination = excluded.destination,
+			sender = excluded.sender,
+			message = excluded.message,
+			content_hash = excluded.content_hash,
+			api_key = excluded.api_key,
+			product = excluded.product,
+			status = excluded.status,
+			attempts = 0,
+			last_error = '',
+			message_id = '',
+			created_at = excluded.created_at,
+			updated_at = excluded.updated_at
+		WHERE outbound_queue.status IN (?, ?)
+	`, record.TrxID, record.Destination, record.Sender, record.Message, record.ContentHash, record.APIKey, record.Product, OutboundStatusPending, now, now,
+		OutboundStatusFailed, OutboundStatusSent)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return false, err
+	}
+
+	err = r.db.QueryRow(`SELECT id FROM outbound_queue WHERE trx_id = ?`, record.TrxID).Scan(&record.ID)
+	if err != nil {
+		return false, err
+	}
+	record.Status = OutboundStatusPending
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	return true, nil
+}
+
+// GetByTrxID gets a queued outbound message by TrxID
+func (r *OutboundRepository) GetByTrxID(trxID string) (*OutboundRecord, error) {
+	row := r.db.QueryRow(`
+		SELECT `+outboundColumns+`
+		FROM outbound_queue
+		WHERE trx_id = ?
+		LIMIT 1
+	`, trxID)
+
+	record, err := scanOutbound(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// ListPending returns pending outbound messages queued after afterID, in FIFO order
+func (r *OutboundRepository) ListPending(afterID int64, limit int) ([]*OutboundRecord, error) {
+	rows, err := r.db.Query(`
+		SELECT `+outboundColumns+`
+		FROM outbound_queue
+		WHERE status = ? AND id > ?
+		ORDER BY id ASC
+		LIMIT ?
+	`, OutboundStatusPending, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*OutboundRecord
+	for rows.Next() {
+		record, err := scanOutbound(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// MarkSending claims a pending message for sending.
+// Returns false if the message was already claimed.
+func (r *OutboundRepository) MarkSending(id int64) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE outbound_queue
+		SET status = ?, attempts = attempts + 1, updated_at = ?
+		WHERE id = ? AND status = ?
+	`, OutboundStatusSending, time.Now(), id, OutboundStatusPending)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// MarkSent marks a message as sent with its WhatsApp message ID
+func (r *OutboundRepository) MarkSent(id int64, messageID string) error {
+	_, err := r.db.Exec(`
+		UPDATE outbound_queue
+		SET status = ?, message_id = ?, last_error = '', updated_at = ?
+		WHERE id = ?
+	`, OutboundStatusSent, messageID, time.Now(), id)
+	return err
+}
+
+// MarkRetry puts a message back to pending after a temporary failure
+func (r *OutboundRepository) MarkRetry(id int64, lastError string) error {
+	_, err := r.db.Exec(`
+		UPDATE outbound_queue
+		SET status = ?, last_error = ?, updated_at = ?
+		WHERE id = ?
+	`, OutboundStatusPending, lastError, time.Now(), id)
+	return err
+}
+
+// MarkFailed marks a message as permanently failed
+func (r *OutboundRepository) MarkFailed(id int64, lastError string) error {
+	_, err := r.db.Exec(`
+		UPDATE outbound_queue
+		SET status = ?, last_error = ?, updated_at = ?
+		WHERE id = ?
+	`, OutboundStatusFailed, lastError, time.Now(), id)
+	return err
+}
+
+// FailInterrupted marks messages left in sending state (e.g. after a crash) as failed.
+// They may or may not have reached WhatsApp, so they are not sent again automatically.
+func (r *OutboundRepository) FailInterrupted(lastError string) ([]*OutboundRecord, error) {
+	rows, err := r.db.Query(`
+		SELECT `+outboundColumns+`
+		FROM outbound_queue
+		WHERE status = ?
+	`, OutboundStatusSending)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*OutboundRecord
+	for rows.Next() {
+		record, err := scanOutbound(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		if err := r.MarkFailed(record.ID, lastError); err != nil {
+			return nil, err
+		}
+		record.Status = OutboundStatusFailed
+		record.LastError = lastError
+	}
+	return records, nil
+}
+
+// PurgeBefore deletes sent and failed messages last updated before the given time
+func (r *OutboundRepository) PurgeBefore(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM outbound_queue WHERE status IN (?, ?) AND updated_at <= ?
+	`, OutboundStatusSent, OutboundStatusFailed, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CountPending returns the number of messages waiting in the queue
+func (r *OutboundRepository) CountPending() (int64, error) {
+	var count int64
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM outbound_queue WHERE status IN (?, ?)
+	`, OutboundStatusPending, OutboundStatusSending).Scan(&count)
+	return count, err
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOutbound scans an outbound_queue row
+func scanOutbound(row rowScanner) (*OutboundRecord, error) {
+	var record OutboundRecord
+	err := row.Scan(
+		&record.ID,
+		&record.TrxID,
+		&record.Destination,
+		&record.Sender,
+		&record.Message,
+		&record.Status,
+		&record.Attempts,
+		&record.LastError,
+		&record.MessageID,
+		&record.ContentHash,
+		&record.APIKey,
+		&record.Product,
+		&record.CreatedAt,
+		&record.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
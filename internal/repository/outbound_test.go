@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutboundRepositoryPurgeBefore(t *testing.T) {
+	repo, err := NewOutboundRepository(newTestTransactionRepository(t).DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		trxID string
+		mark  func(id int64) error
+		kept  bool
+	}{
+		{"TRX-pending", func(id int64) error { return nil }, true},
+		{"TRX-sending", func(id int64) error { _, err := repo.MarkSending(id); return err }, true},
+		{"TRX-sent", func(id int64) error { return repo.MarkSent(id, "3EB0A") }, false},
+		{"TRX-failed", func(id int64) error { return repo.MarkFailed(id, "send failed") }, false},
+	}
+	for _, tt := range tests {
+		record := &OutboundRecord{TrxID: tt.trxID, Destination: "628111@s.whatsapp.net", Message: "message"}
+		if ok, err := repo.Enqueue(record); err != nil || !ok {
+			t.Fatalf("Enqueue() = %v, %v", ok, err)
+		}
+		if err := tt.mark(record.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if purged, err := repo.PurgeBefore(time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+		t.Fatalf("PurgeBefore(an hour ago) = %d, %v, want 0", purged, err)
+	}
+	if purged, err := repo.PurgeBefore(time.Now().Add(time.Second)); err != nil || purged != 2 {
+		t.Fatalf("PurgeBefore(now) = %d, %v, want 2", purged, err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.trxID, func(t *testing.T) {
+			record, err := repo.GetByTrxID(tt.trxID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (record != nil) != tt.kept {
+				t.Errorf("record kept = %v, want %v", record != nil, tt.kept)
+			}
+		})
+	}
+}
+
+func TestOutboundRepositoryEnqueue(t *testing.T) {
+	repo, err := NewOutboundRepository(newTestTransactionRepository(t).DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		mark        func(id int64) error // Puts the first entry in a state before the second Enqueue
+		wantQueued  bool
+		wantProduct string
+	}{
+		{"still pending", func(id int64) error { return nil }, false, "PULSA"},
+		{"still sending", func(id int64) error { _, err := repo.MarkSending(id); return err }, false, "PULSA"},
+		{"failed is replaced", func(id int64) error { return repo.MarkFailed(id, "send failed") }, true, "DATA"},
+		{"sent is replaced", func(id int64) error { return repo.MarkSent(id, "3EB0A") }, true, "DATA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trxID := "TRX-" + tt.name
+			first := &OutboundRecord{TrxID: trxID, Destination: "628111@s.whatsapp.net", Message: "first", Product: "PULSA"}
+			if ok, err := repo.Enqueue(first); err != nil || !ok {
+				t.Fatalf("first Enqueue() = %v, %v", ok, err)
+			}
+			if err := tt.mark(first.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			second := &OutboundRecord{TrxID: trxID, Destination: "628111@s.whatsapp.net", Message: "second", Product: "DATA"}
+			ok, err := repo.Enqueue(second)
+			if err != nil || ok != tt.wantQueued {
+				t.Fatalf("second Enqueue() = %v, %v, want %v", ok, err, tt.wantQueued)
+			}
+
+			stored, err := repo.GetByTrxID(trxID)
+			if err != nil || stored == nil {
+				t.Fatalf("GetByTrxID() = %v, %v", stored, err)
+			}
+			if stored.Product != tt.wantProduct {
+				t.Errorf("stored product = %q, want %q", stored.Product, tt.wantProduct)
+			}
+			if tt.wantQueued && (stored.Status != OutboundStatusPending || stored.Attempts != 0 || stored.MessageID != "") {
+				t.Errorf("replaced entry = %+v", stored)
+			}
+		})
+	}
+}
+
+func TestOutboundRepositoryListPending(t *testing.T) {
+	repo, err := NewOutboundRepository(newTestTransactionRepository(t).DB())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int64
+	for _, trxID := range []string{"T1", "T2", "T3", "T4", "T5"} {
+		record := &OutboundRecord{TrxID: trxID, Destination: "628111@s.whatsapp.net", Message: "message"}
+		if ok, err := repo.Enqueue(record); err != nil || !ok {
+			t.Fatalf("Enqueue() = %v, %v", ok, err)
+		}
+		ids = append(ids, record.ID)
+	}
+	// T3 is being sent, so it's not pending
+	if _, err := repo.MarkSending(ids[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		afterID int64
+		limit   int
+		want    []string
+	}{
+		{"from the start", 0, 10, []string{"T1", "T2", "T4", "T5"}},
+		{"limited", 0, 2, []string{"T1", "T2"}},
+		{"after a page", ids[1], 2, []string{"T4", "T5"}},
+		{"after the last", ids[4], 10, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := repo.ListPending(tt.afterID, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, record := range records {
+				got = append(got, record.TrxID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ListPending() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,24 +1,49 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Transaction statuses, in lifecycle order
+const (
+	TransactionStatusPending   = "pending" // TrxID reserved, message being sent
+	TransactionStatusSent      = "sent"
+	TransactionStatusDelivered = "delivered"
+	TransactionStatusRead      = "read"
+	TransactionStatusReplied   = "replied"
+	TransactionStatusFailed    = "failed"  // Not sent (or interrupted), the TrxID can be used again
+	TransactionStatusExpired   = "expired" // Tracking TTL passed, kept until the retention purge
+)
+
 // TransactionRecord represents a transaction record in database
 type TransactionRecord struct {
-	ID              int64     `json:"id"`
-	TrxID           string    `json:"trx_id"`
-	MessageID       string    `json:"message_id"`
-	Destination     string    `json:"destination"`
-	DestinationType string    `json:"destination_type"`
-	SentAt          time.Time `json:"sent_at"`
-	ExpiresAt       time.Time `json:"expires_at"`
-	CreatedAt       time.Time `json:"created_at"`
+	ID              int64      `json:"id"`
+	TrxID           string     `json:"trx_id"`
+	MessageID       string     `json:"message_id"`
+	Destination     string     `json:"destination"`
+	DestinationType string     `json:"destination_type"`
+	Sender          string     `json:"sender"`
+	SentAt          time.Time  `json:"sent_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	DeliveredAt     *time.Time `json:"delivered_at,omitempty"`
+	ReadAt          *time.Time `json:"read_at,omitempty"`
+	RepliedAt       *time.Time `json:"replied_at,omitempty"`
+	ContentHash     string     `json:"content_hash,omitempty"` // Hash of the request content, to detect retries
+	Delivery        string     `json:"delivery,omitempty"`
+	MediaType       string     `json:"media_type,omitempty"`
+	Status          string     `json:"status"`
+	LastError       string     `json:"last_error,omitempty"`
+	APIKey          string     `json:"api_key,omitempty"` // Name of the API key that forwarded the transaction
+	CreatedAt       time.Time  `json:"created_at"`
 }
 
+// transactionColumns is the column list scanned by scanTransaction
+const transactionColumns = `id, trx_id, message_id, destination, destination_type, sender, sent_at, expires_at, delivered_at, read_at, replied_at, content_hash, delivery, media_type, status, last_error, api_key, created_at`
+
 // TransactionRepository handles database operations for transactions
 type TransactionRepository struct {
 	db *sql.DB
@@ -31,6 +56,10 @@ func NewTransactionRepository(dbPath string) (*TransactionRepository, error) {
 		return nil, err
 	}
 
+	// The tracking database is shared by several repositories and workers;
+	// a single connection serializes writes and avoids "database is locked"
+	db.SetMaxOpenConns(1)
+
 	// Create table if not exists
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS transactions (
@@ -47,101 +76,326 @@ func NewTransactionRepository(dbPath string) (*TransactionRepository, error) {
 		CREATE INDEX IF NOT EXISTS idx_trx_id ON transactions(trx_id);
 		CREATE INDEX IF NOT EXISTS idx_expires_at ON transactions(expires_at);
 		CREATE INDEX IF NOT EXISTS idx_destination ON transactions(destination);
+		CREATE INDEX IF NOT EXISTS idx_message_id ON transactions(message_id);
+
+		CREATE TABLE IF NOT EXISTS health_checks (
+			id INTEGER PRIMARY KEY,
+			checked_at DATETIME NOT NULL
+		);
 	`)
 	if err != nil {
 		db.Close()
 		return nil, err
 	}
 
+	// Columns added after the first release
+	for _, column := range []struct{ name, definition string }{
+		{"delivered_at", "DATETIME"},
+		{"read_at", "DATETIME"},
+		{"sender", "TEXT NOT NULL DEFAULT ''"},
+		{"content_hash", "TEXT NOT NULL DEFAULT ''"},
+		{"delivery", "TEXT NOT NULL DEFAULT ''"},
+		{"media_type", "TEXT NOT NULL DEFAULT ''"},
+		{"status", "TEXT NOT NULL DEFAULT 'sent'"},
+		{"last_error", "TEXT NOT NULL DEFAULT ''"},
+		{"replied_at", "DATETIME"},
+		{"api_key", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		if err := addColumnIfMissing(db, "transactions", column.name, column.definition); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_status ON transactions(status)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return &TransactionRepository{db: db}, nil
 }
 
+// DB returns the underlying database connection, shared by the other tracking repositories
+func (r *TransactionRepository) DB() *sql.DB {
+	return r.db
+}
+
+// Ping checks that the tracking database is reachable and writable
+func (r *TransactionRepository) Ping(ctx context.Context) error {
+	if err := r.db.PingContext(ctx); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT OR REPLACE INTO health_checks (id, checked_at) VALUES (1, ?)
+	`, time.Now())
+	return err
+}
+
 // Close closes database connection
 func (r *TransactionRepository) Close() error {
 	return r.db.Close()
 }
 
-// Save saves a transaction record
-func (r *TransactionRepository) Save(record *TransactionRecord) error {
+// Reserve atomically claims the TrxID of a record about to be sent by inserting it with
+// status pending. A failed record of the same TrxID is replaced; returns false if the
+// TrxID is in use or kept for audit (expired but not yet purged).
+func (r *TransactionRepository) Reserve(record *TransactionRecord) (bool, error) {
+	now := time.Now()
+	result, err := r.db.Exec(`
+		INSERT INTO transactions (trx_id, message_id, destination, destination_type, sender, sent_at, expires_at, content_hash, status, api_key, created_at)
+		VALUES (?, '', ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(trx_id) DO UPDATE SET
+			message_id = '',
+			destination = excluded.destination,
+			destination_type = excluded.destination_type,
+			sender = excluded.sender,
+			sent_at = excluded.sent_at,
+			expires_at = excluded.expires_at,
+			content_hash = excluded.content_hash,
+			delivery = '',
+			media_type = '',
+			delivered_at = NULL,
+			read_at = NULL,
+			replied_at = NULL,
+			status = excluded.status,
+			last_error = '',
+			api_key = excluded.api_key,
+			created_at = excluded.created_at
+		WHERE transactions.status = ?
+	`, record.TrxID, record.Destination, record.DestinationType, record.Sender, now, record.ExpiresAt,
+		record.ContentHash, TransactionStatusPending, record.APIKey, now, TransactionStatusFailed)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return false, err
+	}
+
+	err = r.db.QueryRow(`SELECT id FROM transactions WHERE trx_id = ?`, record.TrxID).Scan(&record.ID)
+	if err != nil {
+		return false, err
+	}
+	record.MessageID = ""
+	record.SentAt = now
+	record.Status = TransactionStatusPending
+	record.CreatedAt = now
+	return true, nil
+}
+
+// MarkSent completes a reserved record with the WhatsApp message ID once the message is sent
+func (r *TransactionRepository) MarkSent(record *TransactionRecord) error {
+	_, err := r.db.Exec(`
+		UPDATE transactions
+		SET message_id = ?, sent_at = ?, expires_at = ?, delivery = ?, media_type = ?, status = ?, last_error = ''
+		WHERE id = ?
+	`, record.MessageID, record.SentAt, record.ExpiresAt, record.Delivery, record.MediaType, TransactionStatusSent, record.ID)
+	if err == nil {
+		record.Status = TransactionStatusSent
+	}
+	return err
+}
+
+// MarkFailed releases a reserved record whose message could not be sent; the TrxID can be reserved again
+func (r *TransactionRepository) MarkFailed(id int64, lastError string) error {
 	_, err := r.db.Exec(`
-		INSERT INTO transactions (trx_id, message_id, destination, destination_type, sent_at, expires_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, record.TrxID, record.MessageID, record.Destination, record.DestinationType, record.SentAt, record.ExpiresAt)
+		UPDATE transactions SET status = ?, last_error = ?
+		WHERE id = ? AND status = ?
+	`, TransactionStatusFailed, lastError, id, TransactionStatusPending)
 	return err
 }
 
+// FailInterrupted marks records still pending, left by a stopped or crashed process, as failed
+func (r *TransactionRepository) FailInterrupted(reason string) (int64, error) {
+	result, err := r.db.Exec(`
+		UPDATE transactions SET status = ?, last_error = ?
+		WHERE status = ?
+	`, TransactionStatusFailed, reason, TransactionStatusPending)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 // GetByTrxID gets a transaction by TrxID (only non-expired)
 func (r *TransactionRepository) GetByTrxID(trxID string) (*TransactionRecord, error) {
-	var record TransactionRecord
-	err := r.db.QueryRow(`
-		SELECT id, trx_id, message_id, destination, destination_type, sent_at, expires_at, created_at
+	return r.queryOne(`
+		SELECT `+transactionColumns+`
 		FROM transactions
 		WHERE trx_id = ? AND expires_at > ?
 		LIMIT 1
-	`, trxID, time.Now()).Scan(
-		&record.ID,
-		&record.TrxID,
-		&record.MessageID,
-		&record.Destination,
-		&record.DestinationType,
-		&record.SentAt,
-		&record.ExpiresAt,
-		&record.CreatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
-	}
-	return &record, nil
+	`, trxID, time.Now())
 }
 
-// GetByDestination gets transactions by destination (only non-expired)
-func (r *TransactionRepository) GetByDestination(destination string) (*TransactionRecord, error) {
-	var record TransactionRecord
-	err := r.db.QueryRow(`
-		SELECT id, trx_id, message_id, destination, destination_type, sent_at, expires_at, created_at
+// FindByTrxID gets a transaction by TrxID, including expired records not yet cleaned up
+func (r *TransactionRepository) FindByTrxID(trxID string) (*TransactionRecord, error) {
+	return r.queryOne(`
+		SELECT `+transactionColumns+`
+		FROM transactions
+		WHERE trx_id = ?
+		LIMIT 1
+	`, trxID)
+}
+
+// GetByDestination gets the latest transaction sent by a device to a destination (only non-expired).
+// Records saved before multi-device support have no sender and match any device.
+func (r *TransactionRepository) GetByDestination(sender, destination string) (*TransactionRecord, error) {
+	return r.queryOne(`
+		SELECT `+transactionColumns+`
 		FROM transactions
-		WHERE destination = ? AND expires_at > ?
+		WHERE destination = ? AND sender IN (?, '') AND expires_at > ? AND status NOT IN (?, ?)
 		ORDER BY sent_at DESC
 		LIMIT 1
-	`, destination, time.Now()).Scan(
-		&record.ID,
-		&record.TrxID,
-		&record.MessageID,
-		&record.Destination,
-		&record.DestinationType,
-		&record.SentAt,
-		&record.ExpiresAt,
-		&record.CreatedAt,
-	)
-	if err == sql.ErrNoRows {
+	`, destination, sender, time.Now(), TransactionStatusPending, TransactionStatusFailed)
+}
+
+// GetByMessageID gets a transaction by the WhatsApp message ID a device sent to a chat (only non-expired)
+func (r *TransactionRepository) GetByMessageID(sender, destination, messageID string) (*TransactionRecord, error) {
+	return r.queryOne(`
+		SELECT `+transactionColumns+`
+		FROM transactions
+		WHERE message_id = ? AND destination = ? AND sender IN (?, '') AND expires_at > ?
+		LIMIT 1
+	`, messageID, destination, sender, time.Now())
+}
+
+// MarkDelivered records the first delivery receipt of a sent message.
+// Returns the updated record, or nil if the message is unknown or already marked.
+func (r *TransactionRepository) MarkDelivered(messageID string, at time.Time) (*TransactionRecord, error) {
+	result, err := r.db.Exec(`
+		UPDATE transactions
+		SET delivered_at = ?, status = CASE WHEN status = ? THEN ? ELSE status END
+		WHERE message_id = ? AND delivered_at IS NULL
+	`, at, TransactionStatusSent, TransactionStatusDelivered, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
 		return nil, nil
 	}
+	return r.findByMessageID(messageID)
+}
+
+// MarkRead records the first read receipt of a sent message (a read message is also delivered).
+// Returns the updated record, or nil if the message is unknown or already marked.
+func (r *TransactionRepository) MarkRead(messageID string, at time.Time) (*TransactionRecord, error) {
+	result, err := r.db.Exec(`
+		UPDATE transactions
+		SET read_at = ?, delivered_at = COALESCE(delivered_at, ?),
+			status = CASE WHEN status IN (?, ?) THEN ? ELSE status END
+		WHERE message_id = ? AND read_at IS NULL
+	`, at, at, TransactionStatusSent, TransactionStatusDelivered, TransactionStatusRead, messageID)
 	if err != nil {
 		return nil, err
 	}
-	return &record, nil
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, nil
+	}
+	return r.findByMessageID(messageID)
+}
+
+// MarkReplied records a reply received for a transaction; the first reply sets the status
+func (r *TransactionRepository) MarkReplied(trxID string, at time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE transactions
+		SET replied_at = COALESCE(replied_at, ?),
+			status = CASE WHEN status IN (?, ?, ?) THEN ? ELSE status END
+		WHERE trx_id = ?
+	`, at, TransactionStatusSent, TransactionStatusDelivered, TransactionStatusRead, TransactionStatusReplied, trxID)
+	return err
+}
+
+// MarkExpired marks transactions whose tracking TTL passed as expired.
+// They are kept, with their delivery and reply timestamps, until purged.
+func (r *TransactionRepository) MarkExpired() (int64, error) {
+	result, err := r.db.Exec(`
+		UPDATE transactions SET status = ?
+		WHERE expires_at <= ? AND status NOT IN (?, ?)
+	`, TransactionStatusExpired, time.Now(), TransactionStatusFailed, TransactionStatusExpired)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
-// CleanupExpired removes expired transaction records
-func (r *TransactionRepository) CleanupExpired() (int64, error) {
+// PurgeBefore deletes transactions (expired or failed) whose tracking ended before the given time
+func (r *TransactionRepository) PurgeBefore(before time.Time) (int64, error) {
 	result, err := r.db.Exec(`
 		DELETE FROM transactions WHERE expires_at <= ?
-	`, time.Now())
+	`, before)
 	if err != nil {
 		return 0, err
 	}
 	return result.RowsAffected()
 }
 
-// Count returns total active (non-expired) transactions
+// Count returns total active (tracked, not failed) transactions
 func (r *TransactionRepository) Count() (int64, error) {
 	var count int64
 	err := r.db.QueryRow(`
-		SELECT COUNT(*) FROM transactions WHERE expires_at > ?
-	`, time.Now()).Scan(&count)
+		SELECT COUNT(*) FROM transactions WHERE expires_at > ? AND status NOT IN (?, ?)
+	`, time.Now(), TransactionStatusFailed, TransactionStatusExpired).Scan(&count)
 	return count, err
 }
 
+// findByMessageID gets a transaction by WhatsApp message ID in any chat, including expired
+func (r *TransactionRepository) findByMessageID(messageID string) (*TransactionRecord, error) {
+	return r.queryOne(`
+		SELECT `+transactionColumns+`
+		FROM transactions
+		WHERE message_id = ?
+		LIMIT 1
+	`, messageID)
+}
+
+// queryOne runs a query returning at most one transaction; nil if none found
+func (r *TransactionRepository) queryOne(query string, args ...interface{}) (*TransactionRecord, error) {
+	record, err := scanTransaction(r.db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// scanTransaction scans a transactions row selected with transactionColumns
+func scanTransaction(row rowScanner) (*TransactionRecord, error) {
+	var record TransactionRecord
+	var deliveredAt, readAt, repliedAt sql.NullTime
+	err := row.Scan(
+		&record.ID,
+		&record.TrxID,
+		&record.MessageID,
+		&record.Destination,
+		&record.DestinationType,
+		&record.Sender,
+		&record.SentAt,
+		&record.ExpiresAt,
+		&deliveredAt,
+		&readAt,
+		&repliedAt,
+		&record.ContentHash,
+		&record.Delivery,
+		&record.MediaType,
+		&record.Status,
+		&record.LastError,
+		&record.APIKey,
+		&record.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if deliveredAt.Valid {
+		record.DeliveredAt = &deliveredAt.Time
+	}
+	if readAt.Valid {
+		record.ReadAt = &readAt.Time
+	}
+	if repliedAt.Valid {
+		record.RepliedAt = &repliedAt.Time
+	}
+	return &record, nil
+}
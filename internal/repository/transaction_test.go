@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestTransactionRepository opens a tracking database in a temporary directory
+func newTestTransactionRepository(t *testing.T) *TransactionRepository {
+	t.Helper()
+	repo, err := NewTransactionRepository(filepath.Join(t.TempDir(), "tracking.db"))
+	if err != nil {
+		t.Fatalf("failed to open tracking database: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestTransactionRepositoryReserve(t *testing.T) {
+	tests := []struct {
+		name string
+		// existing puts the TrxID in a state before the second reservation, nil for a new TrxID
+		existing func(t *testing.T, repo *TransactionRepository, record *TransactionRecord)
+		want     bool
+	}{
+		{
+			name: "new TrxID",
+			want: true,
+		},
+		{
+			name:     "conflict with a pending send",
+			existing: func(t *testing.T, repo *TransactionRepository, record *TransactionRecord) {},
+			want:     false,
+		},
+		{
+			name: "conflict with a tracked send",
+			existing: func(t *testing.T, repo *TransactionRepository, record *TransactionRecord) {
+				record.MessageID = "3EB0A"
+				if err := repo.MarkSent(record); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: false,
+		},
+		{
+			name: "failed send is released",
+			existing: func(t *testing.T, repo *TransactionRepository, record *TransactionRecord) {
+				if err := repo.MarkFailed(record.ID, "send failed"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: true,
+		},
+		{
+			name: "expired send is kept for audit",
+			existing: func(t *testing.T, repo *TransactionRepository, record *TransactionRecord) {
+				record.MessageID = "3EB0A"
+				record.ExpiresAt = time.Now().Add(-time.Minute)
+				if err := repo.MarkSent(record); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestTransactionRepository(t)
+
+			if tt.existing != nil {
+				first := &TransactionRecord{
+					TrxID:       "TRX1",
+					Destination: "628111@s.whatsapp.net",
+					ExpiresAt:   time.Now().Add(time.Hour),
+					ContentHash: "first",
+				}
+				if ok, err := repo.Reserve(first); err != nil || !ok {
+					t.Fatalf("first Reserve() = %v, %v", ok, err)
+				}
+				tt.existing(t, repo, first)
+			}
+
+			second := &TransactionRecord{
+				TrxID:       "TRX1",
+				Destination: "628222@s.whatsapp.net",
+				ExpiresAt:   time.Now().Add(time.Hour),
+				ContentHash: "second",
+				APIKey:      "otomax",
+			}
+			ok, err := repo.Reserve(second)
+			if err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			if ok != tt.want {
+				t.Fatalf("Reserve() = %v, want %v", ok, tt.want)
+			}
+
+			stored, err := repo.FindByTrxID("TRX1")
+			if err != nil || stored == nil {
+				t.Fatalf("FindByTrxID() = %v, %v", stored, err)
+			}
+			if tt.want {
+				// The reservation replaces the released record
+				if stored.ID != second.ID || stored.ContentHash != "second" || stored.Status != TransactionStatusPending ||
+					stored.MessageID != "" || stored.APIKey != "otomax" {
+					t.Errorf("reserved record = %+v", stored)
+				}
+			} else if stored.ContentHash != "first" {
+				t.Errorf("conflicting Reserve() overwrote the record: %+v", stored)
+			}
+		})
+	}
+}
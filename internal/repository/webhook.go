@@ -0,0 +1,417 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookStatusPending   = "pending"
+	WebhookStatusSending   = "sending"
+	WebhookStatusDelivered = "delivered"
+	WebhookStatusDead      = "dead"
+)
+
+// WebhookDelivery represents a webhook payload in the delivery outbox
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	UID            string     `json:"uid"` // Sent as X-Delivery-ID, the same on every attempt
+	TrxID          string     `json:"trx_id"`
+	Event          string     `json:"event"`
+	Payload        string     `json:"payload"`
+	TargetURL      string     `json:"-"` // Overrides the Otomax webhook URL (e.g. alert URL) if set
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// WebhookAttempt represents a single delivery attempt of a webhook
+type WebhookAttempt struct {
+	ID          int64     `json:"id"`
+	DeliveryID  int64     `json:"delivery_id"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// WebhookFilter filters webhook deliveries when listing
+type WebhookFilter struct {
+	Status string
+	TrxID  string
+	Event  string
+	Limit  int
+	Offset int
+}
+
+// webhookDeliveryColumns is the column list scanned by scanWebhookDelivery
+const webhookDeliveryColumns = `id, uid, trx_id, event, payload, target_url, status, attempts, next_attempt_at, last_status_code, last_error, created_at, updated_at, delivered_at`
+
+// WebhookRepository handles database operations for the webhook delivery outbox
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+// NewWebhookRepository creates a new webhook outbox repository on an open tracking database
+func NewWebhookRepository(db *sql.DB) (*WebhookRepository, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			trx_id TEXT NOT NULL,
+			event TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME NOT NULL,
+			last_status_code INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			delivered_at DATETIME
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_webhook_status_next ON webhook_deliveries(status, next_attempt_at);
+		CREATE INDEX IF NOT EXISTS idx_webhook_trx_id ON webhook_deliveries(trx_id);
+
+		CREATE TABLE IF NOT EXISTS webhook_attempts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			delivery_id INTEGER NOT NULL,
+			attempt INTEGER NOT NULL,
+			status_code INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			attempted_at DATETIME NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_webhook_attempts_delivery ON webhook_attempts(delivery_id);
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	// Columns added after the first release
+	for _, column := range []struct{ name, definition string }{
+		{"target_url", "TEXT NOT NULL DEFAULT ''"},
+		{"uid", "TEXT NOT NULL DEFAULT ''"},
+	} {
+		if err := addColumnIfMissing(db, "webhook_deliveries", column.name, column.definition); err != nil {
+			return nil, err
+		}
+	}
+
+	return &WebhookRepository{db: db}, nil
+}
+
+// Create saves a new pending delivery, due immediately
+func (r *WebhookRepository) Create(delivery *WebhookDelivery) error {
+	now := time.Now()
+	result, err := r.db.Exec(`
+		INSERT INTO webhook_deliveries (uid, trx_id, event, payload, target_url, status, next_attempt_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, delivery.UID, delivery.TrxID, delivery.Event, delivery.Payload, delivery.TargetURL, WebhookStatusPending, now, now, now)
+	if err != nil {
+		return err
+	}
+
+	delivery.ID, _ = result.LastInsertId()
+	delivery.Status = WebhookStatusPending
+	delivery.NextAttemptAt = now
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	return nil
+}
+
+// ClaimDue claims pending deliveries whose next attempt is due and marks them as sending
+func (r *WebhookRepository) ClaimDue(limit int) ([]*WebhookDelivery, error) {
+	rows, err := r.db.Query(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at ASC
+		LIMIT ?
+	`, WebhookStatusPending, time.Now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := make([]*WebhookDelivery, 0, len(candidates))
+	for _, delivery := range candidates {
+		result, err := r.db.Exec(`
+			UPDATE webhook_deliveries
+			SET status = ?, attempts = attempts + 1, updated_at = ?
+			WHERE id = ? AND status = ?
+		`, WebhookStatusSending, time.Now(), delivery.ID, WebhookStatusPending)
+		if err != nil {
+			return claimed, err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			continue
+		}
+		delivery.Status = WebhookStatusSending
+		delivery.Attempts++
+		claimed = append(claimed, delivery)
+	}
+	return claimed, nil
+}
+
+// MarkDelivered marks a delivery as successfully delivered
+func (r *WebhookRepository) MarkDelivered(id int64, statusCode int) error {
+	now := time.Now()
+	_, err := r.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, last_status_code = ?, last_error = '', updated_at = ?, delivered_at = ?
+		WHERE id = ?
+	`, WebhookStatusDelivered, statusCode, now, now, id)
+	return err
+}
+
+// MarkRetry schedules another attempt for a failed delivery
+func (r *WebhookRepository) MarkRetry(id int64, nextAttemptAt time.Time, statusCode int, lastError string) error {
+	_, err := r.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, next_attempt_at = ?, last_status_code = ?, last_error = ?, updated_at = ?
+		WHERE id = ?
+	`, WebhookStatusPending, nextAttemptAt, statusCode, lastError, time.Now(), id)
+	return err
+}
+
+// MarkDead moves a delivery to the dead-letter state after its last attempt failed
+func (r *WebhookRepository) MarkDead(id int64, statusCode int, lastError string) error {
+	_, err := r.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, last_status_code = ?, last_error = ?, updated_at = ?
+		WHERE id = ?
+	`, WebhookStatusDead, statusCode, lastError, time.Now(), id)
+	return err
+}
+
+// ResetInterrupted puts deliveries left in sending state (e.g. after a crash) back to pending
+func (r *WebhookRepository) ResetInterrupted() (int64, error) {
+	result, err := r.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, next_attempt_at = ?, updated_at = ?
+		WHERE status = ?
+	`, WebhookStatusPending, time.Now(), time.Now(), WebhookStatusSending)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RecordAttempt saves the outcome of a delivery attempt
+func (r *WebhookRepository) RecordAttempt(attempt *WebhookAttempt) error {
+	_, err := r.db.Exec(`
+		INSERT INTO webhook_attempts (delivery_id, attempt, status_code, error, duration_ms, attempted_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, attempt.DeliveryID, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.DurationMs, attempt.AttemptedAt)
+	return err
+}
+
+// ListAttempts returns all attempts of a delivery, oldest first
+func (r *WebhookRepository) ListAttempts(deliveryID int64) ([]*WebhookAttempt, error) {
+	rows, err := r.db.Query(`
+		SELECT id, delivery_id, attempt, status_code, error, duration_ms, attempted_at
+		FROM webhook_attempts
+		WHERE delivery_id = ?
+		ORDER BY id ASC
+	`, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []*WebhookAttempt{}
+	for rows.Next() {
+		var attempt WebhookAttempt
+		err := rows.Scan(
+			&attempt.ID,
+			&attempt.DeliveryID,
+			&attempt.Attempt,
+			&attempt.StatusCode,
+			&attempt.Error,
+			&attempt.DurationMs,
+			&attempt.AttemptedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, &attempt)
+	}
+	return attempts, rows.Err()
+}
+
+// GetByID gets a delivery by ID
+func (r *WebhookRepository) GetByID(id int64) (*WebhookDelivery, error) {
+	row := r.db.QueryRow(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE id = ?
+	`, id)
+
+	delivery, err := scanWebhookDelivery(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// List returns deliveries matching the filter, newest first
+func (r *WebhookRepository) List(filter WebhookFilter) ([]*WebhookDelivery, error) {
+	query := `
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE 1 = 1`
+	args := []interface{}{}
+
+	if filter.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, filter.Status)
+	}
+	if filter.TrxID != "" {
+		query += ` AND trx_id = ?`
+		args = append(args, filter.TrxID)
+	}
+	if filter.Event != "" {
+		query += ` AND event = ?`
+		args = append(args, filter.Event)
+	}
+	query += ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := scanWebhookDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if deliveries == nil {
+		deliveries = []*WebhookDelivery{}
+	}
+	return deliveries, nil
+}
+
+// Replay schedules a delivery to be sent again immediately with a fresh retry budget.
+// Returns false if the delivery doesn't exist or is currently being sent.
+func (r *WebhookRepository) Replay(id int64) (bool, error) {
+	now := time.Now()
+	result, err := r.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = 0, next_attempt_at = ?, updated_at = ?
+		WHERE id = ? AND status != ?
+	`, WebhookStatusPending, now, now, id, WebhookStatusSending)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ReplayDead schedules all dead-lettered deliveries (optionally for one TrxID) to be sent again
+func (r *WebhookRepository) ReplayDead(trxID string) (int64, error) {
+	now := time.Now()
+	query := `
+		UPDATE webhook_deliveries
+		SET status = ?, attempts = 0, next_attempt_at = ?, updated_at = ?
+		WHERE status = ?`
+	args := []interface{}{WebhookStatusPending, now, now, WebhookStatusDead}
+	if trxID != "" {
+		query += ` AND trx_id = ?`
+		args = append(args, trxID)
+	}
+
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PurgeBefore deletes delivered and dead-lettered deliveries last updated before
+// the given time, together with their attempts
+func (r *WebhookRepository) PurgeBefore(before time.Time) (int64, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM webhook_deliveries WHERE status IN (?, ?) AND updated_at <= ?
+	`, WebhookStatusDelivered, WebhookStatusDead, before)
+	if err != nil {
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	// Also picks up attempts left behind by an earlier interrupted purge
+	_, err = r.db.Exec(`
+		DELETE FROM webhook_attempts WHERE delivery_id NOT IN (SELECT id FROM webhook_deliveries)
+	`)
+	return purged, err
+}
+
+// CountByStatus returns the number of deliveries with the given status
+func (r *WebhookRepository) CountByStatus(status string) (int64, error) {
+	var count int64
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM webhook_deliveries WHERE status = ?
+	`, status).Scan(&count)
+	return count, err
+}
+
+// scanWebhookDeliveries scans and closes webhook_deliveries rows
+func scanWebhookDeliveries(rows *sql.Rows) ([]*WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// scanWebhookDelivery scans a webhook_deliveries row
+func scanWebhookDelivery(row rowScanner) (*WebhookDelivery, error) {
+	var delivery WebhookDelivery
+	var deliveredAt sql.NullTime
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.UID,
+		&delivery.TrxID,
+		&delivery.Event,
+		&delivery.Payload,
+		&delivery.TargetURL,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+		&deliveredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if deliveredAt.Valid {
+		delivery.DeliveredAt = &deliveredAt.Time
+	}
+	return &delivery, nil
+}
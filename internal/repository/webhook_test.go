@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhookRepositoryPurgeBefore(t *testing.T) {
+	db := newTestTransactionRepository(t).DB()
+	repo, err := NewWebhookRepository(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One delivery per status, each with a recorded attempt
+	ids := map[string]int64{}
+	for _, status := range []string{WebhookStatusPending, WebhookStatusSending, WebhookStatusDelivered, WebhookStatusDead} {
+		delivery := &WebhookDelivery{TrxID: "TRX-" + status, Event: "message_received", Payload: "{}"}
+		if err := repo.Create(delivery); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`UPDATE webhook_deliveries SET status = ? WHERE id = ?`, status, delivery.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.RecordAttempt(&WebhookAttempt{DeliveryID: delivery.ID, Attempt: 1, AttemptedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		ids[status] = delivery.ID
+	}
+
+	if purged, err := repo.PurgeBefore(time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+		t.Fatalf("PurgeBefore(an hour ago) = %d, %v, want 0", purged, err)
+	}
+	if purged, err := repo.PurgeBefore(time.Now().Add(time.Second)); err != nil || purged != 2 {
+		t.Fatalf("PurgeBefore(now) = %d, %v, want 2", purged, err)
+	}
+
+	tests := []struct {
+		status string
+		kept   bool
+	}{
+		{WebhookStatusPending, true},
+		{WebhookStatusSending, true},
+		{WebhookStatusDelivered, false},
+		{WebhookStatusDead, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			delivery, err := repo.GetByID(ids[tt.status])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (delivery != nil) != tt.kept {
+				t.Errorf("delivery kept = %v, want %v", delivery != nil, tt.kept)
+			}
+			attempts, err := repo.ListAttempts(ids[tt.status])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(attempts) == 1) != tt.kept {
+				t.Errorf("attempts left = %d, want kept %v", len(attempts), tt.kept)
+			}
+		})
+	}
+}
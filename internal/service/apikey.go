@@ -0,0 +1,450 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"whatsapp-h2h-otomax/internal/config"
+	"whatsapp-h2h-otomax/internal/model"
+	"whatsapp-h2h-otomax/internal/repository"
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+// keysFileCheckInterval is how often the keys file is checked for changes
+const keysFileCheckInterval = 10 * time.Second
+
+// legacyKeyName is the name of the key configured with API_KEY
+const legacyKeyName = "default"
+
+// API key sources
+const (
+	KeySourceEnv    = "env"
+	KeySourceFile   = "file"
+	KeySourceSQLite = "sqlite"
+)
+
+// APIKeyMatch is the key a request authenticated with
+type APIKeyMatch struct {
+	Key *model.APIKey
+	// ValidUntil is set when an expired or rotated secret was used during its grace period
+	ValidUntil *time.Time
+}
+
+// keyEntry is a secret accepted for an API key
+type keyEntry struct {
+	hash       [sha256.Size]byte
+	key        *model.APIKey
+	expiresAt  *time.Time // The secret is deprecated from then on
+	validUntil *time.Time // End of the grace period, nil if the secret doesn't expire
+}
+
+// fileKey is an API key in the keys file. The secret is given either in
+// plain text or as hex encoded SHA-256 hash.
+type fileKey struct {
+	Name      string     `json:"name"`
+	Key       string     `json:"key,omitempty"`
+	KeySHA256 string     `json:"key_sha256,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeyService authenticates requests against the named API keys of the key store
+// (SQLite tracking database or JSON file) and manages the keys of the SQLite store
+type APIKeyService struct {
+	config *config.SecurityConfig
+	repo   *repository.APIKeyRepository // nil for the file store
+	logger *logger.Logger
+
+	mu          sync.RWMutex
+	keys        []*model.APIKey
+	entries     []keyEntry
+	fileModTime time.Time
+
+	stop chan struct{}
+}
+
+// NewAPIKeyService loads the API keys of the configured key store.
+// The keys file is reloaded when it changes; repo is only used by the SQLite store.
+func NewAPIKeyService(cfg *config.SecurityConfig, repo *repository.APIKeyRepository, log *logger.Logger) (*APIKeyService, error) {
+	service := &APIKeyService{
+		config: cfg,
+		logger: log,
+		stop:   make(chan struct{}),
+	}
+	if cfg.KeyStore == KeySourceSQLite {
+		service.repo = repo
+	}
+
+	if err := service.reload(); err != nil {
+		return nil, err
+	}
+
+	service.mu.RLock()
+	log.Info("API keys loaded",
+		"store", cfg.KeyStore,
+		"keys", len(service.keys),
+		"grace_period", cfg.KeyGracePeriod.String(),
+	)
+	service.mu.RUnlock()
+
+	if service.repo == nil {
+		go service.watchFile()
+	}
+
+	return service, nil
+}
+
+// Close stops watching the keys file
+func (s *APIKeyService) Close() {
+	close(s.stop)
+}
+
+// Enabled reports whether any API key is configured; without keys the API is open (local mode)
+func (s *APIKeyService) Enabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries) > 0
+}
+
+// Authenticate returns the key matching a presented secret, or nil if it matches
+// none or has expired. Every secret is compared in constant time.
+func (s *APIKeyService) Authenticate(secret string) *APIKeyMatch {
+	sum := sha256.Sum256([]byte(secret))
+
+	s.mu.RLock()
+	var match *keyEntry
+	for i := range s.entries {
+		// No early exit, the time taken doesn't depend on which key matches
+		if subtle.ConstantTimeCompare(sum[:], s.entries[i].hash[:]) == 1 {
+			match = &s.entries[i]
+		}
+	}
+	s.mu.RUnlock()
+
+	if match == nil {
+		return nil
+	}
+	now := time.Now()
+	if match.validUntil != nil && !now.Before(*match.validUntil) {
+		return nil
+	}
+
+	result := &APIKeyMatch{Key: match.key}
+	if match.expiresAt != nil && !now.Before(*match.expiresAt) {
+		result.ValidUntil = match.validUntil
+	}
+	return result
+}
+
+// List returns all API keys, without secrets
+func (s *APIKeyService) List() []*model.APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.keys)
+}
+
+// Create adds a key to the SQLite store and returns its secret, which is not stored
+func (s *APIKeyService) Create(name string, scopes []string, expiresAt *time.Time) (*model.APIKeySecret, error) {
+	if s.repo == nil {
+		return nil, ErrKeyStoreReadOnly
+	}
+	if err := validateKey(name, scopes); err != nil {
+		return nil, err
+	}
+	if name == legacyKeyName && s.config.APIKey != "" {
+		return nil, fmt.Errorf("%w: %s is reserved for API_KEY", ErrAPIKeyExists, name)
+	}
+
+	secret, hash, err := newAPIKeySecret()
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.repo.Create(&repository.APIKeyRecord{
+		Name:      name,
+		KeyHash:   hash,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+	if !created {
+		return nil, fmt.Errorf("%w: %s", ErrAPIKeyExists, name)
+	}
+
+	s.logger.Info("API key created", "name", name, "scopes", scopes)
+	return s.secretOf(name, secret)
+}
+
+// Rotate replaces the secret of a key of the SQLite store. The old secret keeps
+// working for the grace period, so clients can switch without downtime.
+func (s *APIKeyService) Rotate(name string) (*model.APIKeySecret, error) {
+	if s.repo == nil {
+		return nil, ErrKeyStoreReadOnly
+	}
+
+	secret, hash, err := newAPIKeySecret()
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := s.repo.Rotate(name, hash, time.Now().Add(s.config.KeyGracePeriod))
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate API key: %w", err)
+	}
+	if !rotated {
+		return nil, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, name)
+	}
+
+	s.logger.Info("API key rotated", "name", name, "grace_period", s.config.KeyGracePeriod.String())
+	return s.secretOf(name, secret)
+}
+
+// Revoke deletes a key of the SQLite store; its secrets stop working right away
+func (s *APIKeyService) Revoke(name string) error {
+	if s.repo == nil {
+		return ErrKeyStoreReadOnly
+	}
+
+	deleted, err := s.repo.Delete(name)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if !deleted {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, name)
+	}
+
+	s.logger.Info("API key revoked", "name", name)
+	return s.reload()
+}
+
+// secretOf reloads the keys and returns the key with its new secret
+func (s *APIKeyService) secretOf(name, secret string) (*model.APIKeySecret, error) {
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	for _, key := range s.List() {
+		if key.Name == name && key.Source == KeySourceSQLite {
+			return &model.APIKeySecret{APIKey: key, Key: secret}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, name)
+}
+
+// reload loads the keys of API_KEY and the key store
+func (s *APIKeyService) reload() error {
+	var keys []*model.APIKey
+	var entries []keyEntry
+
+	if s.config.APIKey != "" {
+		key := &model.APIKey{Name: legacyKeyName, Scopes: model.Scopes, Source: KeySourceEnv}
+		keys = append(keys, key)
+		entries = append(entries, keyEntry{hash: sha256.Sum256([]byte(s.config.APIKey)), key: key})
+	}
+
+	var storeKeys []*model.APIKey
+	var storeEntries []keyEntry
+	var modTime time.Time
+	var err error
+	if s.repo != nil {
+		storeKeys, storeEntries, err = s.loadDatabase()
+	} else {
+		storeKeys, storeEntries, modTime, err = s.loadFile()
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.keys = append(keys, storeKeys...)
+	s.entries = append(entries, storeEntries...)
+	s.fileModTime = modTime
+	s.mu.Unlock()
+	return nil
+}
+
+// loadDatabase loads the keys of the SQLite store
+func (s *APIKeyService) loadDatabase() ([]*model.APIKey, []keyEntry, error) {
+	records, err := s.repo.List()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load API keys: %w", err)
+	}
+
+	var keys []*model.APIKey
+	var entries []keyEntry
+	for _, record := range records {
+		createdAt := record.CreatedAt
+		key := &model.APIKey{
+			Name:      record.Name,
+			Scopes:    record.Scopes,
+			Source:    KeySourceSQLite,
+			ExpiresAt: record.ExpiresAt,
+			CreatedAt: &createdAt,
+			RotatedAt: record.RotatedAt,
+		}
+		keys = append(keys, key)
+
+		hash, err := decodeKeyHash(record.KeyHash)
+		if err != nil {
+			return nil, nil, fmt.Errorf("API key %s: %w", record.Name, err)
+		}
+		entries = append(entries, s.newEntry(hash, key, record.ExpiresAt))
+
+		if record.PreviousKeyHash != "" && record.PreviousExpiresAt != nil && time.Now().Before(*record.PreviousExpiresAt) {
+			key.PreviousExpiresAt = record.PreviousExpiresAt
+			previous, err := decodeKeyHash(record.PreviousKeyHash)
+			if err != nil {
+				return nil, nil, fmt.Errorf("API key %s: %w", record.Name, err)
+			}
+			// Deprecated right away, valid until the end of the grace period of the rotation
+			entries = append(entries, keyEntry{
+				hash:       previous,
+				key:        key,
+				expiresAt:  record.RotatedAt,
+				validUntil: record.PreviousExpiresAt,
+			})
+		}
+	}
+	return keys, entries, nil
+}
+
+// loadFile loads the keys of the JSON keys file
+func (s *APIKeyService) loadFile() ([]*model.APIKey, []keyEntry, time.Time, error) {
+	info, err := os.Stat(s.config.KeysFile)
+	if err != nil {
+		return nil, nil, time.Time{}, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+	data, err := os.ReadFile(s.config.KeysFile)
+	if err != nil {
+		return nil, nil, time.Time{}, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var fileKeys []fileKey
+	if err := json.Unmarshal(data, &fileKeys); err != nil {
+		return nil, nil, time.Time{}, fmt.Errorf("failed to parse API keys file %s: %w", s.config.KeysFile, err)
+	}
+
+	var keys []*model.APIKey
+	var entries []keyEntry
+	names := make(map[string]bool)
+	for _, fk := range fileKeys {
+		if err := validateKey(fk.Name, fk.Scopes); err != nil {
+			return nil, nil, time.Time{}, fmt.Errorf("API keys file: %w", err)
+		}
+		if names[fk.Name] || (fk.Name == legacyKeyName && s.config.APIKey != "") {
+			return nil, nil, time.Time{}, fmt.Errorf("API keys file: %w: %s", ErrAPIKeyExists, fk.Name)
+		}
+		names[fk.Name] = true
+
+		var hash [sha256.Size]byte
+		switch {
+		case fk.Key != "" && fk.KeySHA256 == "":
+			hash = sha256.Sum256([]byte(fk.Key))
+		case fk.KeySHA256 != "" && fk.Key == "":
+			if hash, err = decodeKeyHash(fk.KeySHA256); err != nil {
+				return nil, nil, time.Time{}, fmt.Errorf("API keys file: key %s: %w", fk.Name, err)
+			}
+		default:
+			return nil, nil, time.Time{}, fmt.Errorf("API keys file: key %s needs either key or key_sha256", fk.Name)
+		}
+
+		key := &model.APIKey{
+			Name:      fk.Name,
+			Scopes:    fk.Scopes,
+			Source:    KeySourceFile,
+			ExpiresAt: fk.ExpiresAt,
+		}
+		keys = append(keys, key)
+		entries = append(entries, s.newEntry(hash, key, fk.ExpiresAt))
+	}
+	return keys, entries, info.ModTime(), nil
+}
+
+// newEntry creates the entry of a secret expiring at expiresAt, accepted for the grace period after
+func (s *APIKeyService) newEntry(hash [sha256.Size]byte, key *model.APIKey, expiresAt *time.Time) keyEntry {
+	entry := keyEntry{hash: hash, key: key, expiresAt: expiresAt}
+	if expiresAt != nil {
+		validUntil := expiresAt.Add(s.config.KeyGracePeriod)
+		entry.validUntil = &validUntil
+	}
+	return entry
+}
+
+// watchFile reloads the keys file when it changes. A file that fails to load
+// keeps the previous keys in use.
+func (s *APIKeyService) watchFile() {
+	ticker := time.NewTicker(keysFileCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(s.config.KeysFile)
+		if err != nil {
+			s.logger.Error("Failed to check API keys file", "error", err, "path", s.config.KeysFile)
+			continue
+		}
+		s.mu.RLock()
+		changed := !info.ModTime().Equal(s.fileModTime)
+		s.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		if err := s.reload(); err != nil {
+			s.logger.Error("Failed to reload API keys file, keeping previous keys", "error", err)
+			continue
+		}
+		s.logger.Info("API keys file reloaded", "keys", len(s.List()))
+	}
+}
+
+// validateKey checks the name and scopes of a key
+func validateKey(name string, scopes []string) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n/") {
+		return fmt.Errorf("%w: name must be set and contain no spaces or slashes", ErrInvalidAPIKey)
+	}
+	if len(scopes) == 0 {
+		return fmt.Errorf("%w: key %s has no scopes", ErrInvalidAPIKey, name)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(model.Scopes, scope) {
+			return fmt.Errorf("%w: unknown scope %q of key %s (use %s)", ErrInvalidAPIKey, scope, name, strings.Join(model.Scopes, ", "))
+		}
+	}
+	return nil
+}
+
+// newAPIKeySecret generates a random API key secret and its hex encoded SHA-256 hash
+func newAPIKeySecret() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret := hex.EncodeToString(b)
+	hash := sha256.Sum256([]byte(secret))
+	return secret, hex.EncodeToString(hash[:]), nil
+}
+
+// decodeKeyHash decodes a hex encoded SHA-256 hash
+func decodeKeyHash(encoded string) ([sha256.Size]byte, error) {
+	var hash [sha256.Size]byte
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil || len(decoded) != sha256.Size {
+		return hash, fmt.Errorf("invalid SHA-256 key hash")
+	}
+	copy(hash[:], decoded)
+	return hash, nil
+}
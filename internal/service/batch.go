@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"whatsapp-h2h-otomax/internal/model"
+)
+
+// batchConcurrency is the number of destinations of a batch processed at the same time
+const batchConcurrency = 8
+
+// BatchOutcome is the result of one transaction of a batch
+type BatchOutcome struct {
+	Data *model.TransactionData
+	Err  error
+}
+
+// ProcessBatch processes transactions through the rate limiter and returns the outcome of
+// each, in the order of the requests. Different destinations are processed concurrently,
+// transactions to the same chat in order. A TrxID repeated within the batch is a duplicate.
+func (s *TransactionService) ProcessBatch(ctx context.Context, reqs []*model.TransactionRequest) []BatchOutcome {
+	return processBatch(ctx, reqs, s.ProcessTransaction)
+}
+
+// processBatch runs process for each transaction of a batch, see ProcessBatch
+func processBatch(ctx context.Context, reqs []*model.TransactionRequest,
+	process func(context.Context, *model.TransactionRequest) (*model.TransactionData, error)) []BatchOutcome {
+	outcomes := make([]BatchOutcome, len(reqs))
+
+	// Group the transactions by chat, rejecting repeated TrxIDs
+	seen := make(map[string]int, len(reqs))
+	groups := make(map[string][]int)
+	var order []string
+	for i, req := range reqs {
+		if first, ok := seen[req.TrxID]; ok {
+			outcomes[i].Err = fmt.Errorf("%w: TrxID '%s' appears more than once in the batch (first at index %d)",
+				ErrDuplicateTransaction, req.TrxID, first)
+			continue
+		}
+		seen[req.TrxID] = i
+
+		// 0812... and 62812... are the same chat; an invalid destination fails on its own
+		chat := req.Destination
+		if jid, _, err := parseDestination(req.Destination); err == nil {
+			chat = jid.String()
+		}
+		if _, ok := groups[chat]; !ok {
+			order = append(order, chat)
+		}
+		groups[chat] = append(groups[chat], i)
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, batchConcurrency)
+	for _, chat := range order {
+		indexes := groups[chat]
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			for _, i := range indexes {
+				outcomes[i].Data, outcomes[i].Err = process(ctx, reqs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	return outcomes
+}
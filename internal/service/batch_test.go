@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"whatsapp-h2h-otomax/internal/model"
+)
+
+func TestProcessBatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		items [][2]string // TrxID and destination of each transaction
+		// chats lists the indexes expected to be processed in this order, one chat each
+		chats      [][]int
+		duplicates []int
+	}{
+		{
+			name:  "one per destination",
+			items: [][2]string{{"T1", "081234567890"}, {"T2", "081234567891"}, {"T3", "081234567892"}},
+			chats: [][]int{{0}, {1}, {2}},
+		},
+		{
+			name:  "same destination in request order",
+			items: [][2]string{{"T1", "081234567890"}, {"T2", "081234567891"}, {"T3", "081234567890"}, {"T4", "081234567890"}},
+			chats: [][]int{{0, 2, 3}, {1}},
+		},
+		{
+			name:  "destination formats of the same chat",
+			items: [][2]string{{"T1", "081234567890"}, {"T2", "6281234567890"}, {"T3", "+62 812-3456-7890"}, {"T4", "6281234567890@s.whatsapp.net"}},
+			chats: [][]int{{0, 1, 2, 3}},
+		},
+		{
+			name:  "group and invalid destinations",
+			items: [][2]string{{"T1", "120363001@g.us"}, {"T2", "bogus"}, {"T3", "120363001@g.us"}},
+			chats: [][]int{{0, 2}, {1}},
+		},
+		{
+			name:       "duplicate TrxIDs",
+			items:      [][2]string{{"T1", "081234567890"}, {"T2", "081234567891"}, {"T1", "081234567892"}, {"T2", "081234567891"}, {"T1", "081234567890"}},
+			chats:      [][]int{{0}, {1}},
+			duplicates: []int{2, 3, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reqs := make([]*model.TransactionRequest, len(tt.items))
+			index := make(map[*model.TransactionRequest]int, len(reqs))
+			for i, item := range tt.items {
+				reqs[i] = &model.TransactionRequest{TrxID: item[0], Destination: item[1]}
+				index[reqs[i]] = i
+			}
+
+			var mu sync.Mutex
+			var processed []int
+			process := func(ctx context.Context, req *model.TransactionRequest) (*model.TransactionData, error) {
+				mu.Lock()
+				processed = append(processed, index[req])
+				mu.Unlock()
+				// Give other chats a chance to interleave
+				time.Sleep(time.Millisecond)
+				return &model.TransactionData{TrxID: req.TrxID, Destination: req.Destination}, nil
+			}
+
+			outcomes := processBatch(context.Background(), reqs, process)
+			if len(outcomes) != len(reqs) {
+				t.Fatalf("got %d outcomes, want %d", len(outcomes), len(reqs))
+			}
+
+			// Outcomes follow the order of the requests
+			duplicate := make(map[int]bool)
+			for _, i := range tt.duplicates {
+				duplicate[i] = true
+			}
+			for i, outcome := range outcomes {
+				if duplicate[i] {
+					if !errors.Is(outcome.Err, ErrDuplicateTransaction) || outcome.Data != nil {
+						t.Errorf("outcome %d = %+v, want duplicate error", i, outcome)
+					}
+					continue
+				}
+				if outcome.Err != nil || outcome.Data == nil || outcome.Data.Destination != reqs[i].Destination {
+					t.Errorf("outcome %d = %+v, want result of %+v", i, outcome, reqs[i])
+				}
+			}
+
+			// Each chat is processed in request order, duplicates never
+			position := make(map[int]int, len(processed))
+			for n, i := range processed {
+				position[i] = n
+			}
+			if len(processed) != len(reqs)-len(tt.duplicates) {
+				t.Errorf("processed %v, want %d transactions", processed, len(reqs)-len(tt.duplicates))
+			}
+			for _, chat := range tt.chats {
+				for n := 1; n < len(chat); n++ {
+					if position[chat[n]] < position[chat[n-1]] {
+						t.Errorf("processed %v, want %v in order", processed, chat)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestProcessBatchSameChatSequential(t *testing.T) {
+	reqs := []*model.TransactionRequest{
+		{TrxID: "T1", Destination: "081234567890"},
+		{TrxID: "T2", Destination: "6281234567890"},
+		{TrxID: "T3", Destination: "6281234567890@s.whatsapp.net"},
+		{TrxID: "T4", Destination: "081234567891"},
+		{TrxID: "T5", Destination: "081234567892"},
+	}
+
+	var mu sync.Mutex
+	active := make(map[string]int)
+	overlap, maxActive, total := false, 0, 0
+	process := func(ctx context.Context, req *model.TransactionRequest) (*model.TransactionData, error) {
+		jid, _, _ := parseDestination(req.Destination)
+		mu.Lock()
+		active[jid.String()]++
+		total++
+		if active[jid.String()] > 1 {
+			overlap = true
+		}
+		maxActive = max(maxActive, total)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		active[jid.String()]--
+		total--
+		mu.Unlock()
+		return &model.TransactionData{TrxID: req.TrxID}, nil
+	}
+
+	processBatch(context.Background(), reqs, process)
+	if overlap {
+		t.Error("transactions to the same chat were processed concurrently")
+	}
+	if maxActive < 2 {
+		t.Error("different chats were not processed concurrently")
+	}
+}
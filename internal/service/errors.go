@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by transaction processing. They are wrapped with details, so match
+// them with errors.Is; the handler maps each of them to an API error code.
+var (
+	// ErrDuplicateTransaction is returned when the TrxID is still tracked or queued
+	ErrDuplicateTransaction = errors.New("duplicate transaction")
+
+	// ErrInvalidDestination is returned when the destination is not a valid phone number or group JID
+	ErrInvalidDestination = errors.New("invalid destination")
+
+	// ErrGroupNotFound is returned when the group doesn't exist or the device is not a member
+	ErrGroupNotFound = errors.New("group not found or bot not a member")
+
+	// ErrNotOnWhatsApp is returned when the destination phone number has no WhatsApp account
+	ErrNotOnWhatsApp = errors.New("phone number not registered on WhatsApp")
+
+	// ErrNotConnected is returned when the WhatsApp client of the device is not connected
+	ErrNotConnected = errors.New("WhatsApp client not connected")
+
+	// ErrNoLinkedDevice is returned when no WhatsApp device has been paired yet
+	ErrNoLinkedDevice = fmt.Errorf("%w: no linked device", ErrNotConnected)
+
+	// ErrInvalidSender is returned when the requested or routed sender is not a linked device
+	ErrInvalidSender = errors.New("invalid sender")
+
+	// ErrInvalidMedia is returned when an attachment is invalid, empty, too large or not allowed
+	ErrInvalidMedia = errors.New("invalid media")
+
+	// ErrMediaFetchFailed is returned when a media_url can't be downloaded
+	ErrMediaFetchFailed = errors.New("failed to fetch media")
+
+	// ErrInvalidTemplate is returned when the message template fails to render
+	ErrInvalidTemplate = errors.New("invalid template")
+
+	// ErrSendFailed is returned when WhatsApp doesn't accept the message
+	ErrSendFailed = errors.New("failed to send message")
+)
+
+// Errors returned by API key management
+var (
+	// ErrInvalidAPIKey is returned when the name or scopes of an API key are invalid
+	ErrInvalidAPIKey = errors.New("invalid API key")
+
+	// ErrAPIKeyExists is returned when an API key name is already taken
+	ErrAPIKeyExists = errors.New("API key already exists")
+
+	// ErrAPIKeyNotFound is returned when an API key doesn't exist in the key store
+	ErrAPIKeyNotFound = errors.New("API key not found")
+
+	// ErrKeyStoreReadOnly is returned when keys are managed in the keys file instead of SQLite
+	ErrKeyStoreReadOnly = errors.New("API keys are managed in the keys file")
+)
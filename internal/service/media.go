@@ -0,0 +1,325 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"whatsapp-h2h-otomax/internal/config"
+	"whatsapp-h2h-otomax/internal/model"
+	"whatsapp-h2h-otomax/internal/repository"
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+// mediaFetchTimeout bounds the download of media attached to a transaction by URL
+const mediaFetchTimeout = 30 * time.Second
+
+// mediaFetchMaxRedirects is the number of redirects followed when fetching a media_url
+const mediaFetchMaxRedirects = 5
+
+// nonPublicNetworks are special-purpose ranges not covered by the netip.Addr checks
+var nonPublicNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2001::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// MediaService stores media received from WhatsApp and serves it to Otomax
+type MediaService struct {
+	config     *config.MediaConfig
+	repo       *repository.MediaRepository
+	httpClient *http.Client
+	logger     *logger.Logger
+	stop       chan struct{}
+}
+
+// NewMediaService creates a new media service
+func NewMediaService(cfg *config.MediaConfig, repo *repository.MediaRepository, log *logger.Logger) (*MediaService, error) {
+	// Ensure storage directory exists
+	if err := os.MkdirAll(cfg.StoragePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create media directory: %w", err)
+	}
+
+	allowed := make([]netip.Prefix, 0, len(cfg.FetchAllowedNetworks))
+	for _, network := range cfg.FetchAllowedNetworks {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(network)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid MEDIA_FETCH_ALLOWED_NETWORKS entry %q: %w", network, err)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		allowed = append(allowed, prefix.Masked())
+	}
+
+	service := &MediaService{
+		config:     cfg,
+		repo:       repo,
+		httpClient: newMediaFetchClient(allowed),
+		logger:     log,
+		stop:       make(chan struct{}),
+	}
+
+	// Start cleanup goroutine
+	go service.cleanupExpiredPeriodically()
+
+	return service, nil
+}
+
+// Close stops the retention cleanup
+func (s *MediaService) Close() {
+	close(s.stop)
+}
+
+// newMediaFetchClient creates the HTTP client for media_url downloads. It only connects
+// to public addresses (or the allowed networks); the address is checked on every
+// connection after DNS resolution, so redirects and DNS rebinding are covered too.
+func newMediaFetchClient(allowed []netip.Prefix) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("invalid address %s: %w", address, err)
+			}
+			if !fetchAllowed(addrPort.Addr(), allowed) {
+				return fmt.Errorf("address %s is not a public address", addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: mediaFetchTimeout,
+		Transport: &http.Transport{
+			// No proxy: the dialer must see the address of the media host
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= mediaFetchMaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", mediaFetchMaxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// fetchAllowed reports whether media may be fetched from the address
+func fetchAllowed(addr netip.Addr, allowed []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, prefix := range nonPublicNetworks {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// MaxSize returns the maximum size in bytes of media that will be downloaded
+func (s *MediaService) MaxSize() int64 {
+	return int64(s.config.MaxSizeMB) * 1024 * 1024
+}
+
+// Store writes downloaded media to disk and records it for the retention period
+func (s *MediaService) Store(record *repository.MediaRecord, data []byte) (*repository.MediaRecord, error) {
+	id, err := newMediaID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate media ID: %w", err)
+	}
+
+	path := filepath.Join(s.config.StoragePath, id+mediaExtension(record.FileName, record.MimeType))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write media file: %w", err)
+	}
+
+	now := time.Now()
+	record.ID = id
+	record.Path = path
+	record.FileSize = int64(len(data))
+	record.CreatedAt = now
+	record.ExpiresAt = now.Add(s.config.Retention)
+
+	if err := s.repo.Save(record); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to save media record: %w", err)
+	}
+
+	return record, nil
+}
+
+// Fetch downloads media to attach to an outgoing transaction.
+// The media type is detected from the content type unless given.
+func (s *MediaService) Fetch(ctx context.Context, mediaURL, mediaType string) (*model.TransactionMedia, error) {
+	parsed, err := url.Parse(mediaURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: media_url must be an http(s) URL", ErrInvalidMedia)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", mediaURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMedia, err)
+	}
+	req.Header.Set("User-Agent", "whatsapp-h2h-otomax/1.0")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMediaFetchFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%w: unexpected status code: %d", ErrMediaFetchFailed, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, s.MaxSize()+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMediaFetchFailed, err)
+	}
+	if int64(len(data)) > s.MaxSize() {
+		return nil, fmt.Errorf("%w: file too large (max %d MB)", ErrInvalidMedia, s.config.MaxSizeMB)
+	}
+
+	return NewTransactionMedia(data, resp.Header.Get("Content-Type"), path.Base(parsed.Path), mediaType)
+}
+
+// NewTransactionMedia builds a media attachment, detecting the mimetype from the
+// content when it is not provided and the media type from the mimetype
+func NewTransactionMedia(data []byte, mimeType, fileName, mediaType string) (*model.TransactionMedia, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidMedia)
+	}
+
+	if parsed, _, err := mime.ParseMediaType(mimeType); err != nil || parsed == "application/octet-stream" {
+		mimeType = http.DetectContentType(data)
+	}
+	if parsed, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = parsed
+	}
+
+	switch mediaType {
+	case "":
+		mediaType = model.MediaTypeDocument
+		switch mimeType {
+		case "image/jpeg", "image/png":
+			mediaType = model.MediaTypeImage
+		}
+	case model.MediaTypeImage, model.MediaTypeDocument:
+	default:
+		return nil, fmt.Errorf("%w: media_type must be %s or %s", ErrInvalidMedia, model.MediaTypeImage, model.MediaTypeDocument)
+	}
+
+	if fileName == "" || fileName == "/" || fileName == "." {
+		fileName = "attachment" + mediaExtension("", mimeType)
+	}
+
+	return &model.TransactionMedia{
+		Type:     mediaType,
+		FileName: fileName,
+		MimeType: mimeType,
+		Data:     data,
+	}, nil
+}
+
+// Get returns a stored media record, or nil if unknown or expired
+func (s *MediaService) Get(id string) (*repository.MediaRecord, error) {
+	return s.repo.GetByID(id)
+}
+
+// URL returns the download URL of a stored media file
+func (s *MediaService) URL(id string) string {
+	return s.config.PublicBaseURL + "/api/v1/media/" + id
+}
+
+// cleanupExpiredPeriodically removes expired media files every hour
+func (s *MediaService) cleanupExpiredPeriodically() {
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+
+		paths, err := s.repo.ListExpiredPaths()
+		if err != nil {
+			s.logger.Error("Failed to list expired media", "error", err)
+			continue
+		}
+
+		deleted := 0
+		for id, path := range paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				s.logger.Error("Failed to delete expired media file", "error", err, "media_id", id)
+				continue
+			}
+			if err := s.repo.Delete(id); err != nil {
+				s.logger.Error("Failed to delete expired media record", "error", err, "media_id", id)
+				continue
+			}
+			deleted++
+		}
+
+		if deleted > 0 {
+			s.logger.Info("Cleaned up expired media", "count", deleted)
+		}
+	}
+}
+
+// newMediaID generates a random, unguessable media ID
+func newMediaID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// mediaExtension picks a file extension from the original file name or the mimetype
+func mediaExtension(fileName, mimeType string) string {
+	if ext := filepath.Ext(fileName); ext != "" && len(ext) <= 10 {
+		return ext
+	}
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			return exts[0]
+		}
+	}
+	return ""
+}
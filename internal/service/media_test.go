@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"whatsapp-h2h-otomax/internal/config"
+)
+
+func TestFetchAllowed(t *testing.T) {
+	lan := []netip.Prefix{netip.MustParsePrefix("192.168.1.0/24")}
+
+	tests := []struct {
+		addr    string
+		allowed []netip.Prefix
+		want    bool
+	}{
+		{"93.184.216.34", nil, true},
+		{"2606:2800:220:1:248:1893:25c8:1946", nil, true},
+		{"127.0.0.1", nil, false},
+		{"::1", nil, false},
+		{"10.1.2.3", nil, false},
+		{"172.16.0.1", nil, false},
+		{"192.168.1.10", nil, false},
+		{"169.254.169.254", nil, false},
+		{"fe80::1", nil, false},
+		{"fd00::1", nil, false},
+		{"100.64.0.1", nil, false},
+		{"0.0.0.0", nil, false},
+		{"255.255.255.255", nil, false},
+		{"224.0.0.1", nil, false},
+		{"::ffff:127.0.0.1", nil, false},
+		{"::ffff:169.254.169.254", nil, false},
+		{"64:ff9b::a9fe:a9fe", nil, false},
+		{"192.168.1.10", lan, true},
+		{"::ffff:192.168.1.10", lan, true},
+		{"192.168.2.10", lan, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := fetchAllowed(netip.MustParseAddr(tt.addr), tt.allowed); got != tt.want {
+				t.Errorf("fetchAllowed(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaFetchRejectsPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		allowed []netip.Prefix
+		wantErr error
+	}{
+		{"loopback", server.URL, nil, ErrMediaFetchFailed},
+		{"allowed network", server.URL, []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &MediaService{
+				config:     &config.MediaConfig{MaxSizeMB: 1},
+				httpClient: newMediaFetchClient(tt.allowed),
+			}
+			_, err := service.Fetch(context.Background(), tt.url, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Fetch() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
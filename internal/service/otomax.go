@@ -3,22 +3,53 @@ package service
 import (
 	"bytes"
 	"context"
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"math"
+	"math/rand/v2"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"whatsapp-h2h-otomax/internal/config"
+	"whatsapp-h2h-otomax/internal/metrics"
 	"whatsapp-h2h-otomax/internal/model"
+	"whatsapp-h2h-otomax/internal/repository"
 	"whatsapp-h2h-otomax/pkg/logger"
+	"whatsapp-h2h-otomax/pkg/webhooksig"
 )
 
+// webhookPollInterval is how often workers look for deliveries whose backoff has elapsed
+const webhookPollInterval = time.Second
+
+// webhookClaimBatch is the number of deliveries a worker claims at once
+const webhookClaimBatch = 10
+
 // OtomaxService handles webhook delivery to Otomax
 type OtomaxService struct {
 	httpClient *http.Client
 	config     *config.OtomaxConfig
 	logger     *logger.Logger
+	outbox     *repository.WebhookRepository
+	wake       chan struct{}
+	stop       chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+
+	lastMu      sync.Mutex
+	lastAttempt *WebhookAttemptResult
+}
+
+// WebhookAttemptResult describes the outcome of a webhook call to Otomax
+type WebhookAttemptResult struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	// Failed calls in a row up to this one, 0 if it succeeded
+	ConsecutiveFailures int `json:"consecutive_failures"`
 }
 
 // NewOtomaxService creates a new Otomax service
@@ -29,70 +60,368 @@ func NewOtomaxService(cfg *config.OtomaxConfig, log *logger.Logger) *OtomaxServi
 		},
 		config: cfg,
 		logger: log,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
 	}
 }
 
-// SendWebhook sends webhook payload to Otomax with retry mechanism
-func (s *OtomaxService) SendWebhook(ctx context.Context, payload *model.WebhookPayload, trxID string) error {
-	var lastErr error
+// Start starts the background delivery workers on the webhook outbox.
+// Deliveries interrupted by a previous shutdown are replayed.
+func (s *OtomaxService) Start(outbox *repository.WebhookRepository) {
+	s.outbox = outbox
 
-	for attempt := 0; attempt <= s.config.RetryCount; attempt++ {
-		if attempt > 0 {
-			backoff := time.Duration(math.Pow(2, float64(attempt-1))) * time.Second
-			s.logger.WithTrxID(trxID).Warn("Retrying webhook delivery",
-				"attempt", attempt+1,
-				"backoff_seconds", backoff.Seconds(),
-			)
-			time.Sleep(backoff)
+	replayed, err := outbox.ResetInterrupted()
+	if err != nil {
+		s.logger.Error("Failed to reset interrupted webhook deliveries", "error", err)
+	}
+	pending, _ := outbox.CountByStatus(repository.WebhookStatusPending)
+	if pending > 0 {
+		s.logger.Info("Pending webhook deliveries restored",
+			"count", pending,
+			"interrupted", replayed,
+		)
+	}
+
+	for i := 0; i < s.config.Workers; i++ {
+		s.wg.Add(1)
+		go s.runWorker()
+	}
+}
+
+// Stop stops the delivery workers, waiting for in-flight deliveries to finish.
+// Undelivered payloads stay in the outbox and are sent after the next start.
+func (s *OtomaxService) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	s.wg.Wait()
+}
+
+// SendWebhook queues webhook payload for delivery to Otomax and returns the ID of the outbox delivery
+func (s *OtomaxService) SendWebhook(ctx context.Context, payload *model.WebhookPayload, trxID string) (int64, error) {
+	return s.enqueue(payload.Event, trxID, payload)
+}
+
+// SendTransactionStatus queues a transaction status update for delivery to Otomax
+func (s *OtomaxService) SendTransactionStatus(ctx context.Context, payload *model.TransactionStatusPayload) error {
+	_, err := s.enqueue(payload.Event, payload.TrxID, payload)
+	return err
+}
+
+// SendMessageStatus queues a message delivery/read receipt for delivery to Otomax
+func (s *OtomaxService) SendMessageStatus(ctx context.Context, payload *model.MessageStatusPayload) error {
+	_, err := s.enqueue(payload.Event, payload.TrxID, payload)
+	return err
+}
+
+// SendSessionStatus queues a WhatsApp session alert for delivery to the alert URL,
+// or to the Otomax webhook if no alert URL is configured
+func (s *OtomaxService) SendSessionStatus(ctx context.Context, payload *model.SessionStatusPayload) error {
+	_, err := s.enqueueTo(s.config.AlertURL, payload.Event, "", payload)
+	return err
+}
+
+// enqueue stores the payload for the Otomax webhook in the outbox and wakes up a worker
+func (s *OtomaxService) enqueue(event, trxID string, payload interface{}) (int64, error) {
+	return s.enqueueTo("", event, trxID, payload)
+}
+
+// enqueueTo stores the payload for the given URL (empty: Otomax webhook) in the outbox and wakes up a worker.
+// Returns the ID of the delivery.
+func (s *OtomaxService) enqueueTo(targetURL, event, trxID string, payload interface{}) (int64, error) {
+	if s.outbox == nil {
+		return 0, fmt.Errorf("webhook outbox not started")
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	uid, err := newDeliveryUID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate delivery ID: %w", err)
+	}
+
+	delivery := &repository.WebhookDelivery{
+		UID:       uid,
+		TrxID:     trxID,
+		Event:     event,
+		Payload:   string(jsonData),
+		TargetURL: targetURL,
+	}
+	if err := s.outbox.Create(delivery); err != nil {
+		return 0, fmt.Errorf("failed to queue webhook: %w", err)
+	}
+
+	s.notify()
+	return delivery.ID, nil
+}
+
+// LastAttempt returns the outcome of the last call to the Otomax webhook, nil if none since start
+func (s *OtomaxService) LastAttempt() *WebhookAttemptResult {
+	s.lastMu.Lock()
+	defer s.lastMu.Unlock()
+
+	if s.lastAttempt == nil {
+		return nil
+	}
+	last := *s.lastAttempt
+	return &last
+}
+
+// CountDeliveries returns the number of webhook deliveries with the given status
+func (s *OtomaxService) CountDeliveries(status string) (int64, error) {
+	if s.outbox == nil {
+		return 0, fmt.Errorf("webhook outbox not started")
+	}
+	return s.outbox.CountByStatus(status)
+}
+
+// ListDeliveries returns webhook deliveries matching the filter
+func (s *OtomaxService) ListDeliveries(filter repository.WebhookFilter) ([]*repository.WebhookDelivery, error) {
+	if s.outbox == nil {
+		return nil, fmt.Errorf("webhook outbox not started")
+	}
+	return s.outbox.List(filter)
+}
+
+// GetDelivery returns a webhook delivery with its attempts, or nil if not found
+func (s *OtomaxService) GetDelivery(id int64) (*repository.WebhookDelivery, []*repository.WebhookAttempt, error) {
+	if s.outbox == nil {
+		return nil, nil, fmt.Errorf("webhook outbox not started")
+	}
+
+	delivery, err := s.outbox.GetByID(id)
+	if err != nil || delivery == nil {
+		return nil, nil, err
+	}
+
+	attempts, err := s.outbox.ListAttempts(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return delivery, attempts, nil
+}
+
+// ReplayDelivery schedules a webhook delivery to be sent again right away
+func (s *OtomaxService) ReplayDelivery(id int64) (bool, error) {
+	if s.outbox == nil {
+		return false, fmt.Errorf("webhook outbox not started")
+	}
+
+	replayed, err := s.outbox.Replay(id)
+	if err != nil {
+		return false, err
+	}
+	if replayed {
+		s.logger.Info("Webhook delivery replay requested", "delivery_id", id)
+		s.notify()
+	}
+	return replayed, nil
+}
+
+// ReplayDeadDeliveries schedules all dead-lettered deliveries (optionally for one TrxID) to be sent again
+func (s *OtomaxService) ReplayDeadDeliveries(trxID string) (int64, error) {
+	if s.outbox == nil {
+		return 0, fmt.Errorf("webhook outbox not started")
+	}
+
+	count, err := s.outbox.ReplayDead(trxID)
+	if err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		s.logger.Info("Dead-lettered webhook deliveries replay requested", "count", count, "trxid", trxID)
+		s.notify()
+	}
+	return count, nil
+}
+
+// notify wakes up one idle worker
+func (s *OtomaxService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runWorker delivers due webhooks until the service is stopped
+func (s *OtomaxService) runWorker() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake:
+		case <-ticker.C:
 		}
 
-		err := s.send(ctx, payload)
-		if err == nil {
-			// Only log if retry attempt or first time success
-			if attempt > 0 {
-				s.logger.WithTrxID(trxID).Info("Webhook delivered",
-					"attempt", attempt+1,
-				)
+		for {
+			deliveries, err := s.outbox.ClaimDue(webhookClaimBatch)
+			if err != nil {
+				s.logger.Error("Failed to claim webhook deliveries", "error", err)
+			}
+			for _, delivery := range deliveries {
+				s.attempt(delivery)
+			}
+			if len(deliveries) < webhookClaimBatch {
+				break
 			}
-			return nil
 		}
+	}
+}
 
-		lastErr = err
-		s.logger.WithTrxID(trxID).Warn("Webhook delivery failed",
-			"attempt", attempt+1,
+// attempt performs one delivery attempt and records the outcome
+func (s *OtomaxService) attempt(delivery *repository.WebhookDelivery) {
+	log := s.logger.WithTrxID(delivery.TrxID)
+
+	startedAt := time.Now()
+	targetURL := delivery.TargetURL
+	if targetURL == "" {
+		targetURL = s.config.WebhookURL
+	}
+	deliveryUID := delivery.UID
+	if deliveryUID == "" {
+		// Queued by a version without delivery IDs
+		deliveryUID = strconv.FormatInt(delivery.ID, 10)
+	}
+	statusCode, err := s.send(context.Background(), targetURL, deliveryUID, []byte(delivery.Payload))
+
+	attempt := &repository.WebhookAttempt{
+		DeliveryID:  delivery.ID,
+		Attempt:     delivery.Attempts,
+		StatusCode:  statusCode,
+		DurationMs:  time.Since(startedAt).Milliseconds(),
+		AttemptedAt: startedAt,
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	target := "otomax"
+	if delivery.TargetURL != "" {
+		target = "alert"
+	}
+	metrics.ObserveWebhookAttempt(target, statusCode)
+	if err := s.outbox.RecordAttempt(attempt); err != nil {
+		log.Error("Failed to record webhook attempt", "error", err, "delivery_id", delivery.ID)
+	}
+	if delivery.TargetURL == "" {
+		s.lastMu.Lock()
+		failures := 0
+		if attempt.Error != "" {
+			failures = 1
+			if s.lastAttempt != nil {
+				failures += s.lastAttempt.ConsecutiveFailures
+			}
+		}
+		s.lastAttempt = &WebhookAttemptResult{
+			AttemptedAt:         attempt.AttemptedAt,
+			StatusCode:          attempt.StatusCode,
+			Error:               attempt.Error,
+			DurationMs:          attempt.DurationMs,
+			ConsecutiveFailures: failures,
+		}
+		s.lastMu.Unlock()
+	}
+
+	if err == nil {
+		if err := s.outbox.MarkDelivered(delivery.ID, statusCode); err != nil {
+			log.Error("Failed to mark webhook as delivered", "error", err, "delivery_id", delivery.ID)
+		}
+		// Only log if retry attempt or first time success
+		if delivery.Attempts > 1 {
+			log.Info("Webhook delivered",
+				"attempt", delivery.Attempts,
+				"delivery_id", delivery.ID,
+			)
+		}
+		return
+	}
+
+	maxAttempts := s.config.RetryCount + 1
+	if delivery.Attempts >= maxAttempts {
+		log.Error("Webhook delivery failed, moved to dead-letter",
+			"attempts", delivery.Attempts,
+			"event", delivery.Event,
+			"delivery_id", delivery.ID,
 			"error", err,
 		)
+		if err := s.outbox.MarkDead(delivery.ID, statusCode, err.Error()); err != nil {
+			log.Error("Failed to mark webhook as dead", "error", err, "delivery_id", delivery.ID)
+		}
+		return
 	}
 
-	return fmt.Errorf("webhook delivery failed after %d attempts: %w",
-		s.config.RetryCount+1, lastErr)
+	backoff := s.backoff(delivery.Attempts)
+	log.Warn("Webhook delivery failed, retry scheduled",
+		"attempt", delivery.Attempts,
+		"backoff_seconds", backoff.Seconds(),
+		"delivery_id", delivery.ID,
+		"error", err,
+	)
+	if err := s.outbox.MarkRetry(delivery.ID, time.Now().Add(backoff), statusCode, err.Error()); err != nil {
+		log.Error("Failed to schedule webhook retry", "error", err, "delivery_id", delivery.ID)
+	}
 }
 
-// send performs the actual HTTP request to Otomax webhook
-func (s *OtomaxService) send(ctx context.Context, payload *model.WebhookPayload) error {
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %w", err)
+// backoff returns the exponential backoff with jitter after the given attempt:
+// a random duration between half and the full base * 2^(attempt-1), capped at the maximum
+func (s *OtomaxService) backoff(attempt int) time.Duration {
+	backoff := s.config.BackoffBase
+	for i := 1; i < attempt && backoff < s.config.BackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > s.config.BackoffMax {
+		backoff = s.config.BackoffMax
 	}
+	if backoff <= 0 {
+		return 0
+	}
+
+	half := backoff / 2
+	return half + time.Duration(rand.Int64N(int64(half)+1))
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", s.config.WebhookURL, bytes.NewBuffer(jsonData))
+// send performs the actual HTTP request to Otomax webhook (or alert URL).
+// The body is signed with the webhook secret if one is configured.
+func (s *OtomaxService) send(ctx context.Context, url, deliveryUID string, jsonData []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return 0, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "whatsapp-h2h-otomax/1.0")
+	if s.config.WebhookSecret != "" {
+		webhooksig.SetHeaders(req.Header, []byte(s.config.WebhookSecret), deliveryUID, jsonData, time.Now())
+	} else {
+		req.Header.Set(webhooksig.HeaderTimestamp, strconv.FormatInt(time.Now().Unix(), 10))
+		req.Header.Set(webhooksig.HeaderDeliveryID, deliveryUID)
+	}
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return 0, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	return nil
+	return resp.StatusCode, nil
 }
 
+// newDeliveryUID generates a random, globally unique webhook delivery ID
+func newDeliveryUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := crand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
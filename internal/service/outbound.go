@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-h2h-otomax/internal/config"
+	"whatsapp-h2h-otomax/internal/model"
+	"whatsapp-h2h-otomax/internal/repository"
+)
+
+// DeliveryAsync is reported for transactions accepted into the outbound queue
+const DeliveryAsync = "async"
+
+// outboundBatchSize is the number of queued messages processed per drain
+const outboundBatchSize = 50
+
+// outboundSendTimeout bounds a single queued send (validation + rate limiter + send)
+const outboundSendTimeout = 2 * time.Minute
+
+// StartOutboundWorker starts the background worker that drains the outbound queue.
+// The queue is drained every time WhatsApp (re)connects and periodically after that.
+func (s *TransactionService) StartOutboundWorker(cfg *config.OutboundQueueConfig) {
+	s.outboundCfg = cfg
+
+	// Messages left in "sending" state were interrupted by a crash or restart
+	interrupted, err := s.outbound.FailInterrupted("interrupted during send, delivery unknown")
+	if err != nil {
+		s.logger.Error("Failed to recover interrupted outbound messages", "error", err)
+	}
+	for _, record := range interrupted {
+		s.logger.WithTrxID(record.TrxID).Warn("Outbound message interrupted during send, marked as failed")
+		s.reportStatus(record)
+	}
+
+	if pending, err := s.outbound.CountPending(); err == nil && pending > 0 {
+		s.logger.Info("Pending outbound messages restored", "count", pending)
+	}
+
+	s.sessions.AddConnectedHandler(s.wakeOutbound)
+
+	go s.runOutboundWorker()
+}
+
+// enqueueTransaction persists the transaction with its formatted message in the outbound queue
+func (s *TransactionService) enqueueTransaction(req *model.TransactionRequest, message, hash string) (*model.TransactionData, error) {
+	if s.outboundCfg == nil {
+		return nil, fmt.Errorf("async mode is not enabled")
+	}
+
+	// Resolve the sender now, routing rules may depend on the product.
+	// Without any linked device yet, the sender is chosen when sending.
+	record := &repository.OutboundRecord{
+		TrxID:       req.TrxID,
+		Destination: req.Destination,
+		Message:     message,
+		ContentHash: hash,
+		APIKey:      req.APIKey,
+		Product:     req.Product,
+	}
+	session, err := s.sessions.Route(req.Sender, req.Destination, req.Product)
+	if err != nil && !errors.Is(err, ErrNoLinkedDevice) {
+		return nil, err
+	}
+	if session != nil {
+		record.Sender = session.ID()
+	}
+
+	queued, err := s.outbound.Enqueue(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue transaction: %w", err)
+	}
+	if !queued {
+		return nil, fmt.Errorf("%w: TrxID '%s' is already queued for delivery", ErrDuplicateTransaction, req.TrxID)
+	}
+
+	s.logger.WithTrxID(req.TrxID).WithAPIKey(req.APIKey).Info("Transaction queued for async delivery",
+		"destination", req.Destination,
+		"queue_id", record.ID,
+		"sender", record.Sender,
+		"whatsapp_connected", s.sessions.IsConnected(),
+	)
+
+	s.wakeOutbound()
+
+	return &model.TransactionData{
+		TrxID:       req.TrxID,
+		Destination: req.Destination,
+		Sender:      record.Sender,
+		Timestamp:   record.CreatedAt,
+		Status:      repository.OutboundStatusPending,
+		Delivery:    DeliveryAsync,
+	}, nil
+}
+
+// wakeOutbound asks the worker to drain the queue
+func (s *TransactionService) wakeOutbound() {
+	select {
+	case s.outboundWake <- struct{}{}:
+	default:
+	}
+}
+
+// runOutboundWorker drains the queue when woken up or when the retry interval elapses
+func (s *TransactionService) runOutboundWorker() {
+	ticker := time.NewTicker(s.outboundCfg.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.outboundWake:
+		case <-ticker.C:
+		}
+
+		if s.drainOutbound() {
+			s.wakeOutbound()
+		}
+	}
+}
+
+// drainOutbound sends up to one batch of pending messages. Messages whose sender is
+// offline stay queued without being claimed, so they don't hold up the other senders.
+// Returns true if a full batch was sent and there may be more messages ready to send.
+func (s *TransactionService) drainOutbound() bool {
+	if !s.sessions.IsConnected() {
+		return false
+	}
+
+	var afterID int64
+	processed, sent := 0, 0
+	for processed < outboundBatchSize {
+		records, err := s.outbound.ListPending(afterID, outboundBatchSize)
+		if err != nil {
+			s.logger.Error("Failed to list pending outbound messages", "error", err)
+			return false
+		}
+
+		for _, record := range records {
+			afterID = record.ID
+			if !s.sessions.IsConnected() {
+				s.logger.Warn("WhatsApp disconnected, outbound queue paused")
+				return false
+			}
+			if !s.senderOnline(record) {
+				continue
+			}
+			if s.processQueued(record) {
+				sent++
+			}
+			if processed++; processed == outboundBatchSize {
+				break
+			}
+		}
+
+		if len(records) < outboundBatchSize {
+			return false
+		}
+	}
+
+	return sent > 0
+}
+
+// senderOnline reports whether the session routed for a queued message is connected.
+// An invalid sender counts as online, sending fails it permanently.
+func (s *TransactionService) senderOnline(record *repository.OutboundRecord) bool {
+	session, err := s.sessions.Route(record.Sender, record.Destination, record.Product)
+	if err != nil {
+		return !errors.Is(err, ErrNoLinkedDevice)
+	}
+	return session.IsConnected()
+}
+
+// processQueued sends a single queued message and reports the final status to Otomax.
+// Returns true if the message was sent.
+func (s *TransactionService) processQueued(record *repository.OutboundRecord) bool {
+	log := s.logger.WithTrxID(record.TrxID).WithAPIKey(record.APIKey)
+
+	claimed, err := s.outbound.MarkSending(record.ID)
+	if err != nil {
+		log.Error("Failed to claim outbound message", "error", err)
+		return false
+	}
+	if !claimed {
+		return false
+	}
+	record.Attempts++
+
+	ctx, cancel := context.WithTimeout(context.Background(), outboundSendTimeout)
+	defer cancel()
+
+	permanent := false
+	session, err := s.sessions.Route(record.Sender, record.Destination, record.Product)
+	if err == nil {
+		var jid types.JID
+		var destType string
+		jid, destType, err = session.ValidateDestination(record.Destination)
+		if err == nil {
+			var data *model.TransactionData
+			data, err = s.sendTransaction(ctx, session, record.TrxID, record.APIKey, jid, destType, record.Message, record.ContentHash, nil)
+			if err == nil {
+				if err := s.outbound.MarkSent(record.ID, data.MessageID); err != nil {
+					log.Error("Failed to mark outbound message as sent", "error", err)
+				}
+				record.Status = repository.OutboundStatusSent
+				record.Destination = data.Destination
+				record.Sender = data.Sender
+				record.MessageID = data.MessageID
+				s.reportStatus(record)
+				return true
+			}
+			// The TrxID was sent by another request meanwhile
+			permanent = errors.Is(err, ErrDuplicateTransaction)
+		} else {
+			// Not connected or WhatsApp unreachable may still succeed on retry
+			permanent = errors.Is(err, ErrInvalidDestination) ||
+				errors.Is(err, ErrGroupNotFound) ||
+				errors.Is(err, ErrNotOnWhatsApp)
+		}
+	} else {
+		// An unknown sender won't become valid by retrying
+		permanent = !errors.Is(err, ErrNoLinkedDevice)
+	}
+
+	// Retry later if the failure may be temporary, otherwise give up
+	offline := (session == nil && !permanent) || (session != nil && !session.IsConnected())
+	if offline || (record.Attempts < s.outboundCfg.MaxAttempts && !permanent) {
+		log.Warn("Outbound message send failed, will retry",
+			"error", err,
+			"attempt", record.Attempts,
+		)
+		if err := s.outbound.MarkRetry(record.ID, err.Error()); err != nil {
+			log.Error("Failed to requeue outbound message", "error", err)
+		}
+		return false
+	}
+
+	log.Error("Outbound message failed permanently",
+		"error", err,
+		"attempts", record.Attempts,
+	)
+	if err := s.outbound.MarkFailed(record.ID, err.Error()); err != nil {
+		log.Error("Failed to mark outbound message as failed", "error", err)
+	}
+	record.Status = repository.OutboundStatusFailed
+	record.LastError = err.Error()
+	s.reportStatus(record)
+	return false
+}
+
+// reportStatus sends the final status of a queued transaction to Otomax
+func (s *TransactionService) reportStatus(record *repository.OutboundRecord) {
+	if s.otomaxService == nil {
+		return
+	}
+
+	payload := &model.TransactionStatusPayload{
+		Event:       "transaction_status",
+		TrxID:       record.TrxID,
+		Status:      record.Status,
+		Destination: record.Destination,
+		Sender:      record.Sender,
+		MessageID:   record.MessageID,
+		Error:       record.LastError,
+		Timestamp:   time.Now(),
+	}
+
+	if err := s.otomaxService.SendTransactionStatus(context.Background(), payload); err != nil {
+		s.logger.WithTrxID(record.TrxID).Error("Failed to queue transaction status webhook",
+			"error", err,
+			"status", record.Status,
+		)
+	}
+}
@@ -0,0 +1,409 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+	waLog "go.mau.fi/whatsmeow/util/log"
+
+	"whatsapp-h2h-otomax/internal/config"
+	"whatsapp-h2h-otomax/internal/repository"
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+// senderRoute is a routing rule choosing the sender device of a transaction
+type senderRoute struct {
+	product string // Match by product code ("product:<code>=<sender>")
+	pattern string // Match by destination, a trailing * matches a prefix
+	sender  string
+}
+
+// SessionPool manages the WhatsApp sessions of all linked devices (sender numbers)
+type SessionPool struct {
+	container     *sqlstore.Container
+	config        *config.WhatsAppConfig
+	logger        *logger.Logger
+	routes        []senderRoute
+	defaultSender string
+
+	mu       sync.RWMutex
+	sessions []*WhatsAppService
+
+	// Dependencies shared by all sessions
+	otomaxService     *OtomaxService
+	mediaService      *MediaService
+	repo              *repository.TransactionRepository
+	messages          *repository.MessageRepository
+	webhookWhitelist  []string
+	connectedHandlers []func()
+}
+
+// NewSessionPool creates a session for every device in the session store.
+// A new unpaired device is added if there is none yet or if cfg.AddDevice is set.
+func NewSessionPool(cfg *config.WhatsAppConfig, log *logger.Logger) (*SessionPool, error) {
+	ctx := context.Background()
+
+	routes, err := parseSenderRoutes(cfg.SenderRoutes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure database directory exists
+	dbDir := filepath.Dir(cfg.DBPath)
+	if err := os.MkdirAll(dbDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	log.Info("Database directory ready", "path", dbDir)
+
+	// Setup database for session storage
+	container, err := sqlstore.New(ctx, "sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on", cfg.DBPath), waLog.Noop)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create store: %w", err)
+	}
+
+	devices, err := container.GetAllDevices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices: %w", err)
+	}
+
+	pool := &SessionPool{
+		container:     container,
+		config:        cfg,
+		logger:        log,
+		routes:        routes,
+		defaultSender: cfg.DefaultSender,
+	}
+
+	for _, device := range devices {
+		pool.sessions = append(pool.sessions, newWhatsAppService(device, cfg, log))
+	}
+
+	if len(devices) == 0 || cfg.AddDevice {
+		pool.sessions = append(pool.sessions, newWhatsAppService(container.NewDevice(), cfg, log))
+	}
+
+	log.Info("WhatsApp devices loaded",
+		"linked", len(devices),
+		"sessions", len(pool.sessions),
+		"routes", len(routes),
+	)
+
+	return pool, nil
+}
+
+// SetOtomaxService sets the Otomax service for webhook delivery on all sessions
+func (p *SessionPool) SetOtomaxService(otomaxService *OtomaxService) {
+	p.otomaxService = otomaxService
+	p.configureAll()
+}
+
+// SetMediaService sets the media service used to store received media on all sessions
+func (p *SessionPool) SetMediaService(mediaService *MediaService) {
+	p.mediaService = mediaService
+	p.configureAll()
+}
+
+// SetTransactionRepository sets the transaction repository for tracking on all sessions
+func (p *SessionPool) SetTransactionRepository(repo *repository.TransactionRepository) {
+	p.repo = repo
+	p.configureAll()
+}
+
+// SetMessageRepository sets the repository logging the messages of transactions on all sessions
+func (p *SessionPool) SetMessageRepository(messages *repository.MessageRepository) {
+	p.messages = messages
+	p.configureAll()
+}
+
+// SetWebhookWhitelist sets the whitelist of JIDs/Groups allowed for webhook on all sessions
+func (p *SessionPool) SetWebhookWhitelist(whitelist []string) {
+	p.webhookWhitelist = whitelist
+	p.configureAll()
+}
+
+// AddConnectedHandler registers a callback run every time any session (re)connects
+func (p *SessionPool) AddConnectedHandler(handler func()) {
+	p.mu.Lock()
+	p.connectedHandlers = append(p.connectedHandlers, handler)
+	p.mu.Unlock()
+
+	for _, session := range p.Sessions() {
+		session.AddConnectedHandler(handler)
+	}
+}
+
+// configureAll applies the shared dependencies to all sessions
+func (p *SessionPool) configureAll() {
+	for _, session := range p.Sessions() {
+		p.configure(session)
+	}
+}
+
+// configure applies the shared dependencies to a session
+func (p *SessionPool) configure(session *WhatsAppService) {
+	session.SetOtomaxService(p.otomaxService)
+	session.SetMediaService(p.mediaService)
+	session.SetTransactionRepository(p.repo)
+	session.SetMessageRepository(p.messages)
+	session.SetWebhookWhitelist(p.webhookWhitelist)
+
+	p.mu.RLock()
+	connectedHandlers := append([]func(){}, p.connectedHandlers...)
+	p.mu.RUnlock()
+	session.setHooks(connectedHandlers, p.replace)
+}
+
+// Connect connects all sessions. Linked devices connect first (and keep
+// reconnecting in the background if they fail); unpaired devices then start
+// the QR code login flow in the background.
+func (p *SessionPool) Connect() error {
+	sessions := p.Sessions()
+
+	for _, session := range sessions {
+		if session.ID() == "" {
+			continue
+		}
+		// Failed devices keep reconnecting in the background with backoff
+		if err := session.Connect(); err != nil {
+			session.log().Error("Failed to connect WhatsApp device, will retry", "error", err)
+		}
+	}
+
+	for _, session := range sessions {
+		if session.ID() != "" {
+			continue
+		}
+		// Login can be retried through the session API
+		if err := session.Connect(); err != nil {
+			session.log().Error("Failed to start WhatsApp login", "error", err)
+		}
+	}
+
+	return nil
+}
+
+// Pending returns the first device waiting to be paired, or nil if all devices are linked
+func (p *SessionPool) Pending() *WhatsAppService {
+	for _, session := range p.Sessions() {
+		if session.ID() == "" {
+			return session
+		}
+	}
+	return nil
+}
+
+// Logout unlinks the device of a sender number and replaces it with a new
+// unpaired device, so the number (or another one) can be linked again remotely
+func (p *SessionPool) Logout(ctx context.Context, sender string) error {
+	session := p.Get(sender)
+	if session == nil {
+		return fmt.Errorf("%w: %s is not a linked device", ErrInvalidSender, sender)
+	}
+
+	if err := session.Logout(ctx); err != nil {
+		return err
+	}
+
+	p.replace(session)
+	return nil
+}
+
+// replace swaps a logged out session for a new unpaired device
+func (p *SessionPool) replace(session *WhatsAppService) {
+	session.stopReconnect()
+
+	replacement := newWhatsAppService(p.container.NewDevice(), p.config, p.logger)
+	p.configure(replacement)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, existing := range p.sessions {
+		if existing == session {
+			p.sessions[i] = replacement
+			return
+		}
+	}
+}
+
+// Disconnect disconnects all sessions
+func (p *SessionPool) Disconnect() {
+	for _, session := range p.Sessions() {
+		session.Disconnect()
+	}
+}
+
+// Sessions returns all sessions, ordered by phone number (unpaired devices first)
+func (p *SessionPool) Sessions() []*WhatsAppService {
+	p.mu.RLock()
+	sessions := make([]*WhatsAppService, len(p.sessions))
+	copy(sessions, p.sessions)
+	p.mu.RUnlock()
+
+	// Devices may be paired at any time, so order on every call
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ID() < sessions[j].ID()
+	})
+	return sessions
+}
+
+// Get returns the session of a sender phone number, or nil if it is not a linked device
+func (p *SessionPool) Get(sender string) *WhatsAppService {
+	normalized := normalizePhoneNumber(sender)
+	for _, session := range p.Sessions() {
+		if id := session.ID(); id != "" && (id == sender || id == normalized) {
+			return session
+		}
+	}
+	return nil
+}
+
+// Route chooses the session sending a transaction: the requested sender, then the
+// first matching routing rule, then the default sender, then the first connected device
+func (p *SessionPool) Route(sender, destination, product string) (*WhatsAppService, error) {
+	if sender != "" {
+		session := p.Get(sender)
+		if session == nil {
+			return nil, fmt.Errorf("%w: %s is not a linked device", ErrInvalidSender, sender)
+		}
+		return session, nil
+	}
+
+	if routed := p.matchRoute(destination, product); routed != "" {
+		session := p.Get(routed)
+		if session == nil {
+			return nil, fmt.Errorf("%w: routing rule sender %s is not a linked device", ErrInvalidSender, routed)
+		}
+		return session, nil
+	}
+
+	if p.defaultSender != "" {
+		session := p.Get(p.defaultSender)
+		if session == nil {
+			return nil, fmt.Errorf("%w: default sender %s is not a linked device", ErrInvalidSender, p.defaultSender)
+		}
+		return session, nil
+	}
+
+	var fallback *WhatsAppService
+	for _, session := range p.Sessions() {
+		if session.ID() == "" {
+			continue
+		}
+		if session.IsConnected() {
+			return session, nil
+		}
+		if fallback == nil {
+			fallback = session
+		}
+	}
+	if fallback == nil {
+		return nil, ErrNoLinkedDevice
+	}
+	return fallback, nil
+}
+
+// matchRoute returns the sender of the first routing rule matching the transaction
+func (p *SessionPool) matchRoute(destination, product string) string {
+	if len(p.routes) == 0 {
+		return ""
+	}
+
+	// Destination may be matched as given, as JID or as phone number
+	keys := []string{destination}
+	if jid, _, err := parseDestination(destination); err == nil {
+		keys = append(keys, jid.String(), jid.User)
+	}
+
+	for _, route := range p.routes {
+		if route.product != "" {
+			if strings.EqualFold(route.product, product) {
+				return route.sender
+			}
+			continue
+		}
+		for _, key := range keys {
+			if prefix, ok := strings.CutSuffix(route.pattern, "*"); ok {
+				if strings.HasPrefix(key, prefix) {
+					return route.sender
+				}
+			} else if key == route.pattern {
+				return route.sender
+			}
+		}
+	}
+	return ""
+}
+
+// IsConnected checks if any linked session is connected.
+// Unpaired devices keep a websocket open while waiting for pairing and don't count.
+func (p *SessionPool) IsConnected() bool {
+	for _, session := range p.Sessions() {
+		if session.ID() != "" && session.IsConnected() {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDestination parses a destination into a JID without contacting WhatsApp
+func (p *SessionPool) ParseDestination(destination string) (types.JID, string, error) {
+	return parseDestination(destination)
+}
+
+// GetConnectionStatus returns the connection status of all devices
+func (p *SessionPool) GetConnectionStatus() map[string]interface{} {
+	devices := make([]map[string]interface{}, 0)
+	for _, session := range p.Sessions() {
+		devices = append(devices, session.GetConnectionStatus())
+	}
+
+	return map[string]interface{}{
+		"connected": p.IsConnected(),
+		"devices":   devices,
+	}
+}
+
+// PrintJoinedGroups displays the joined groups of all connected devices to console
+func (p *SessionPool) PrintJoinedGroups(ctx context.Context) {
+	sessions := p.Sessions()
+	for _, session := range sessions {
+		if !session.IsConnected() {
+			continue
+		}
+		if len(sessions) > 1 {
+			fmt.Printf("\n📱 Device: %s\n", session.ID())
+		}
+		session.PrintJoinedGroups(ctx)
+	}
+}
+
+// parseSenderRoutes parses routing rules of the form "<destination>=<sender>" or "product:<code>=<sender>"
+func parseSenderRoutes(rules []string) ([]senderRoute, error) {
+	routes := make([]senderRoute, 0, len(rules))
+	for _, rule := range rules {
+		key, sender, ok := strings.Cut(rule, "=")
+		key = strings.TrimSpace(key)
+		sender = strings.TrimSpace(sender)
+		if !ok || key == "" || sender == "" {
+			return nil, fmt.Errorf("invalid sender route %q (use <destination>=<sender> or product:<kode>=<sender>)", rule)
+		}
+
+		route := senderRoute{sender: sender}
+		if product, isProduct := strings.CutPrefix(key, "product:"); isProduct {
+			route.product = product
+		} else {
+			route.pattern = key
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"whatsapp-h2h-otomax/internal/config"
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+// ErrSendQueueFull is returned when the outbound send queue has no room left
+var ErrSendQueueFull = errors.New("send queue is full, rate limit exceeded")
+
+// errSchedulerStopped is returned to queued sends when the scheduler shuts down
+var errSchedulerStopped = errors.New("send scheduler stopped")
+
+// Delivery modes reported for a scheduled send
+const (
+	DeliveryImmediate = "immediate"
+	DeliveryQueued    = "queued"
+)
+
+// SendFunc performs the actual WhatsApp send and returns the message ID
+type SendFunc func(ctx context.Context) (string, error)
+
+// ScheduleInfo describes how a message went through the scheduler
+type ScheduleInfo struct {
+	Delivery      string
+	QueuePosition int
+	Waited        time.Duration
+}
+
+// sendJob is a send waiting in the scheduler queue
+type sendJob struct {
+	ctx         context.Context
+	destination string
+	send        SendFunc
+	enqueuedAt  time.Time
+	result      chan sendResult
+}
+
+// sendResult is the outcome of a queued send
+type sendResult struct {
+	messageID string
+	err       error
+}
+
+// SendScheduler paces outbound messages with a global token bucket
+// and a minimum interval between messages to the same destination
+type SendScheduler struct {
+	mu         sync.Mutex
+	rate       float64
+	burst      float64
+	tokens     float64
+	lastRefill time.Time
+	spacing    time.Duration
+	lastSent   map[string]time.Time
+	queue      []*sendJob
+	maxQueue   int
+	wake       chan struct{}
+	stop       chan struct{}
+	stopOnce   sync.Once
+	logger     *logger.Logger
+}
+
+// NewSendScheduler creates a new send scheduler and starts its worker
+func NewSendScheduler(cfg *config.RateLimitConfig, log *logger.Logger) *SendScheduler {
+	rate := float64(cfg.MaxMessagesPerSecond)
+
+	scheduler := &SendScheduler{
+		rate:       rate,
+		burst:      rate,
+		tokens:     rate,
+		lastRefill: time.Now(),
+		spacing:    cfg.PerDestinationInterval,
+		lastSent:   make(map[string]time.Time),
+		maxQueue:   cfg.SendQueueSize,
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		logger:     log,
+	}
+
+	go scheduler.run()
+
+	return scheduler
+}
+
+// Send sends a message through the scheduler. The message is sent right away
+// when the rate limit allows it, otherwise it waits in the queue until its turn.
+func (s *SendScheduler) Send(ctx context.Context, destination string, send SendFunc) (string, *ScheduleInfo, error) {
+	s.mu.Lock()
+
+	now := time.Now()
+	s.refill(now)
+
+	// Fast path: nothing queued and both limits allow sending now
+	if len(s.queue) == 0 && s.hasToken() && s.destinationReady(destination, now) {
+		s.take(destination, now)
+		s.mu.Unlock()
+
+		messageID, err := send(ctx)
+		return messageID, &ScheduleInfo{Delivery: DeliveryImmediate}, err
+	}
+
+	if s.maxQueue > 0 && len(s.queue) >= s.maxQueue {
+		s.mu.Unlock()
+		return "", nil, ErrSendQueueFull
+	}
+
+	job := &sendJob{
+		ctx:         ctx,
+		destination: destination,
+		send:        send,
+		enqueuedAt:  now,
+		result:      make(chan sendResult, 1),
+	}
+	s.queue = append(s.queue, job)
+	info := &ScheduleInfo{
+		Delivery:      DeliveryQueued,
+		QueuePosition: len(s.queue),
+	}
+	s.mu.Unlock()
+
+	s.logger.Debug("Message queued by rate limiter",
+		"destination", destination,
+		"queue_position", info.QueuePosition,
+	)
+	s.notify()
+
+	select {
+	case res := <-job.result:
+		info.Waited = time.Since(job.enqueuedAt)
+		return res.messageID, info, res.err
+	case <-ctx.Done():
+		if s.remove(job) {
+			return "", info, ctx.Err()
+		}
+		// Already dispatched: the message may be on its way, wait for the outcome
+		res := <-job.result
+		info.Waited = time.Since(job.enqueuedAt)
+		return res.messageID, info, res.err
+	}
+}
+
+// QueueLength returns the number of messages waiting to be sent
+func (s *SendScheduler) QueueLength() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// Stop stops the scheduler and fails all queued sends
+func (s *SendScheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// run dispatches queued sends as soon as the rate limits allow
+func (s *SendScheduler) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		job, wait := s.next(time.Now())
+		s.mu.Unlock()
+
+		if job != nil {
+			go s.execute(job)
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if wait > 0 {
+			timer.Reset(wait)
+		}
+
+		select {
+		case <-s.stop:
+			s.failQueued()
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// next pops the first queued job that may be sent now. When nothing can be
+// sent it returns how long to wait; zero means wait for a new job.
+func (s *SendScheduler) next(now time.Time) (*sendJob, time.Duration) {
+	if len(s.queue) == 0 {
+		return nil, 0
+	}
+
+	s.refill(now)
+	if !s.hasToken() {
+		return nil, time.Duration((1 - s.tokens) / s.rate * float64(time.Second))
+	}
+
+	var wait time.Duration
+	for i, job := range s.queue {
+		if s.destinationReady(job.destination, now) {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			s.take(job.destination, now)
+			return job, 0
+		}
+
+		remaining := s.spacing - now.Sub(s.lastSent[job.destination])
+		if wait == 0 || remaining < wait {
+			wait = remaining
+		}
+	}
+
+	return nil, wait
+}
+
+// execute runs a dequeued send and delivers its result
+func (s *SendScheduler) execute(job *sendJob) {
+	if err := job.ctx.Err(); err != nil {
+		job.result <- sendResult{err: err}
+		return
+	}
+
+	messageID, err := job.send(job.ctx)
+	job.result <- sendResult{messageID: messageID, err: err}
+}
+
+// remove drops a job from the queue, e.g. when its caller gave up waiting.
+// Returns false if the job already left the queue to be sent.
+func (s *SendScheduler) remove(job *sendJob) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, queued := range s.queue {
+		if queued == job {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// failQueued fails every job still waiting in the queue
+func (s *SendScheduler) failQueued() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.queue {
+		job.result <- sendResult{err: errSchedulerStopped}
+	}
+	s.queue = nil
+}
+
+// notify wakes up the worker
+func (s *SendScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// refill adds tokens for the time elapsed since the last refill
+func (s *SendScheduler) refill(now time.Time) {
+	if s.rate <= 0 {
+		return
+	}
+
+	s.tokens += now.Sub(s.lastRefill).Seconds() * s.rate
+	if s.tokens > s.burst {
+		s.tokens = s.burst
+	}
+	s.lastRefill = now
+
+	// Forget destinations whose spacing has passed so the map doesn't grow forever
+	if len(s.lastSent) > 1024 {
+		for destination, sentAt := range s.lastSent {
+			if now.Sub(sentAt) >= s.spacing {
+				delete(s.lastSent, destination)
+			}
+		}
+	}
+}
+
+// hasToken reports whether the global rate limit allows another send
+func (s *SendScheduler) hasToken() bool {
+	return s.rate <= 0 || s.tokens >= 1
+}
+
+// destinationReady reports whether the destination spacing has passed
+func (s *SendScheduler) destinationReady(destination string, now time.Time) bool {
+	lastSent, ok := s.lastSent[destination]
+	return !ok || now.Sub(lastSent) >= s.spacing
+}
+
+// take consumes a token and records the send time for the destination
+func (s *SendScheduler) take(destination string, now time.Time) {
+	if s.rate > 0 {
+		s.tokens--
+	}
+	if s.spacing > 0 {
+		s.lastSent[destination] = now
+	}
+}
@@ -0,0 +1,326 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"whatsapp-h2h-otomax/internal/config"
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+// sendOK is a SendFunc that succeeds right away
+func sendOK(ctx context.Context) (string, error) {
+	return "3EB0A", nil
+}
+
+func TestSendSchedulerNext(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		rate    int
+		spacing time.Duration
+		sent    map[string]time.Duration // Destinations sent to, and how long ago
+		queue   []string
+		want    string // Destination dispatched, empty if none
+		wait    time.Duration
+	}{
+		{
+			name:  "empty queue",
+			rate:  2,
+			queue: nil,
+		},
+		{
+			name:  "token available",
+			rate:  2,
+			queue: []string{"A"},
+			want:  "A",
+		},
+		{
+			name:  "out of tokens",
+			rate:  2,
+			sent:  map[string]time.Duration{"A": 0, "B": 0},
+			queue: []string{"C"},
+			wait:  500 * time.Millisecond,
+		},
+		{
+			name:  "unlimited rate",
+			rate:  0,
+			sent:  map[string]time.Duration{"A": 0, "B": 0, "C": 0},
+			queue: []string{"D"},
+			want:  "D",
+		},
+		{
+			name:    "destination spacing",
+			rate:    10,
+			spacing: time.Second,
+			sent:    map[string]time.Duration{"A": 400 * time.Millisecond},
+			queue:   []string{"A"},
+			wait:    600 * time.Millisecond,
+		},
+		{
+			name:    "spacing passed",
+			rate:    10,
+			spacing: time.Second,
+			sent:    map[string]time.Duration{"A": time.Second},
+			queue:   []string{"A"},
+			want:    "A",
+		},
+		{
+			name:    "skips a destination still spaced",
+			rate:    10,
+			spacing: time.Second,
+			sent:    map[string]time.Duration{"A": 0},
+			queue:   []string{"A", "B"},
+			want:    "B",
+		},
+		{
+			name:    "waits for the destination free first",
+			rate:    10,
+			spacing: time.Second,
+			sent:    map[string]time.Duration{"A": 200 * time.Millisecond, "B": 700 * time.Millisecond},
+			queue:   []string{"A", "B"},
+			wait:    300 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Not started, next is driven with a fixed time
+			s := &SendScheduler{
+				rate:       float64(tt.rate),
+				burst:      float64(tt.rate),
+				tokens:     float64(tt.rate),
+				lastRefill: now,
+				spacing:    tt.spacing,
+				lastSent:   make(map[string]time.Time),
+			}
+			for destination, ago := range tt.sent {
+				s.take(destination, now.Add(-ago))
+			}
+			for _, destination := range tt.queue {
+				s.queue = append(s.queue, &sendJob{destination: destination})
+			}
+
+			job, wait := s.next(now)
+			got := ""
+			if job != nil {
+				got = job.destination
+			}
+			if got != tt.want {
+				t.Errorf("next() dispatched %q, want %q", got, tt.want)
+			}
+			if diff := wait - tt.wait; diff < -time.Millisecond || diff > time.Millisecond {
+				t.Errorf("next() wait = %v, want %v", wait, tt.wait)
+			}
+			if job != nil && len(s.queue) != len(tt.queue)-1 {
+				t.Errorf("dispatched job still queued, queue length %d", len(s.queue))
+			}
+		})
+	}
+}
+
+func TestSendSchedulerPacing(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          config.RateLimitConfig
+		destinations []string
+		want         []string      // Delivery of each send
+		minWait      time.Duration // Minimum wait of the last send
+	}{
+		{
+			name:         "within rate",
+			cfg:          config.RateLimitConfig{MaxMessagesPerSecond: 3},
+			destinations: []string{"A", "B", "C"},
+			want:         []string{DeliveryImmediate, DeliveryImmediate, DeliveryImmediate},
+		},
+		{
+			name:         "over rate",
+			cfg:          config.RateLimitConfig{MaxMessagesPerSecond: 5},
+			destinations: []string{"A", "B", "C", "D", "E", "F"},
+			want:         []string{DeliveryImmediate, DeliveryImmediate, DeliveryImmediate, DeliveryImmediate, DeliveryImmediate, DeliveryQueued},
+			minWait:      150 * time.Millisecond,
+		},
+		{
+			name:         "same destination",
+			cfg:          config.RateLimitConfig{MaxMessagesPerSecond: 100, PerDestinationInterval: 200 * time.Millisecond},
+			destinations: []string{"A", "B", "A"},
+			want:         []string{DeliveryImmediate, DeliveryImmediate, DeliveryQueued},
+			minWait:      150 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSendScheduler(&tt.cfg, logger.New("error"))
+			defer s.Stop()
+
+			var last *ScheduleInfo
+			for i, destination := range tt.destinations {
+				messageID, info, err := s.Send(context.Background(), destination, sendOK)
+				if err != nil || messageID != "3EB0A" {
+					t.Fatalf("send %d = %q, %v", i, messageID, err)
+				}
+				if info.Delivery != tt.want[i] {
+					t.Errorf("send %d delivery = %s, want %s", i, info.Delivery, tt.want[i])
+				}
+				last = info
+			}
+			if last.Waited < tt.minWait {
+				t.Errorf("last send waited %v, want at least %v", last.Waited, tt.minWait)
+			}
+		})
+	}
+}
+
+func TestSendSchedulerQueueFull(t *testing.T) {
+	tests := []struct {
+		queueSize int
+		queued    int // Sends waiting in the queue before the last one
+		wantFull  bool
+	}{
+		{queueSize: 1, queued: 0, wantFull: false},
+		{queueSize: 1, queued: 1, wantFull: true},
+		{queueSize: 3, queued: 2, wantFull: false},
+		{queueSize: 3, queued: 3, wantFull: true},
+		{queueSize: 0, queued: 5, wantFull: false}, // Unlimited queue
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("size %d with %d queued", tt.queueSize, tt.queued), func(t *testing.T) {
+			// One message per minute: after the first send everything else waits
+			s := NewSendScheduler(&config.RateLimitConfig{MaxMessagesPerSecond: 1, SendQueueSize: tt.queueSize}, logger.New("error"))
+			s.mu.Lock()
+			s.rate = 1.0 / 60
+			s.mu.Unlock()
+
+			if _, info, err := s.Send(context.Background(), "A", sendOK); err != nil || info.Delivery != DeliveryImmediate {
+				t.Fatalf("first send = %+v, %v", info, err)
+			}
+
+			results := make(chan error, tt.queued+1)
+			send := func(destination string) {
+				_, _, err := s.Send(context.Background(), destination, sendOK)
+				results <- err
+			}
+			for i := 0; i < tt.queued; i++ {
+				go send(fmt.Sprintf("Q%d", i))
+			}
+			deadline := time.Now().Add(time.Second)
+			for s.QueueLength() < tt.queued && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if got := s.QueueLength(); got != tt.queued {
+				t.Fatalf("queue length = %d, want %d", got, tt.queued)
+			}
+
+			go send("last")
+			var full bool
+			select {
+			case err := <-results:
+				if !errors.Is(err, ErrSendQueueFull) {
+					t.Fatalf("send returned %v before the scheduler stopped", err)
+				}
+				full = true
+			case <-time.After(50 * time.Millisecond):
+			}
+			if full != tt.wantFull {
+				t.Errorf("queue full = %v, want %v", full, tt.wantFull)
+			}
+
+			// Stopping fails everything still queued
+			s.Stop()
+			waiting := tt.queued
+			if !full {
+				waiting++
+			}
+			for i := 0; i < waiting; i++ {
+				if err := <-results; !errors.Is(err, errSchedulerStopped) {
+					t.Errorf("queued send after Stop() = %v, want %v", err, errSchedulerStopped)
+				}
+			}
+		})
+	}
+}
+
+func TestSendSchedulerCancel(t *testing.T) {
+	tests := []struct {
+		name       string
+		dispatched bool // Cancel after the queued send started instead of while it waits
+		wantErr    error
+		wantSent   bool
+	}{
+		{"cancelled while queued", false, context.Canceled, false},
+		{"cancelled while sending", true, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The second message to the same destination waits for the spacing
+			s := NewSendScheduler(&config.RateLimitConfig{MaxMessagesPerSecond: 100, PerDestinationInterval: 100 * time.Millisecond}, logger.New("error"))
+			defer s.Stop()
+			if _, _, err := s.Send(context.Background(), "A", sendOK); err != nil {
+				t.Fatal(err)
+			}
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			sent := false
+			send := func(ctx context.Context) (string, error) {
+				close(started)
+				<-release
+				sent = true
+				return "3EB0B", nil
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			type result struct {
+				messageID string
+				err       error
+			}
+			done := make(chan result, 1)
+			go func() {
+				messageID, _, err := s.Send(ctx, "A", send)
+				done <- result{messageID, err}
+			}()
+
+			if tt.dispatched {
+				<-started
+				cancel()
+				// Send must keep waiting for the message on its way
+				select {
+				case res := <-done:
+					t.Fatalf("Send() returned %+v while the message was being sent", res)
+				case <-time.After(20 * time.Millisecond):
+				}
+				close(release)
+			} else {
+				for s.QueueLength() == 0 {
+					time.Sleep(time.Millisecond)
+				}
+				cancel()
+			}
+
+			res := <-done
+			if !errors.Is(res.err, tt.wantErr) {
+				t.Errorf("Send() error = %v, want %v", res.err, tt.wantErr)
+			}
+			if sent != tt.wantSent || (tt.wantSent && res.messageID != "3EB0B") {
+				t.Errorf("sent = %v with ID %q, want sent %v", sent, res.messageID, tt.wantSent)
+			}
+			if !tt.dispatched {
+				// The cancelled job must not be sent once its turn comes
+				time.Sleep(150 * time.Millisecond)
+				select {
+				case <-started:
+					t.Error("cancelled message was sent")
+				default:
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-h2h-otomax/internal/model"
+)
+
+// Connection states of a WhatsApp device
+const (
+	ConnectionStateUnpaired       = "unpaired"
+	ConnectionStateConnecting     = "connecting"
+	ConnectionStateConnected      = "connected"
+	ConnectionStateDisconnected   = "disconnected"
+	ConnectionStateLoggedOut      = "logged_out"
+	ConnectionStateBanned         = "banned"
+	ConnectionStateStreamReplaced = "stream_replaced"
+	ConnectionStateClientOutdated = "client_outdated"
+)
+
+// connectionState tracks the connection state of a device and its reconnect schedule
+type connectionState struct {
+	mu                sync.Mutex
+	state             string
+	since             time.Time
+	reason            string
+	phone             string    // Last known number, the session is deleted on logout
+	disconnectedAt    time.Time // Start of the current outage, zero while connected
+	totalDisconnected time.Duration
+	attempts          int // Reconnect attempts since the last successful connection
+	nextAttemptAt     time.Time
+	timer             *time.Timer
+	stopped           bool
+}
+
+// ConnectionInfo describes the connection state of a device
+type ConnectionInfo struct {
+	State             string     `json:"state"`
+	Since             time.Time  `json:"since"`
+	Reason            string     `json:"reason,omitempty"`
+	DisconnectedFor   string     `json:"disconnected_for,omitempty"`
+	TotalDisconnected string     `json:"total_disconnected"`
+	ReconnectAttempts int        `json:"reconnect_attempts,omitempty"`
+	NextReconnectAt   *time.Time `json:"next_reconnect_at,omitempty"`
+}
+
+// ConnectionInfo returns the connection state of the device and the time spent disconnected
+func (s *WhatsAppService) ConnectionInfo() ConnectionInfo {
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+
+	now := time.Now()
+	info := ConnectionInfo{
+		State:             s.conn.state,
+		Since:             s.conn.since,
+		Reason:            s.conn.reason,
+		TotalDisconnected: s.conn.totalDisconnected.Round(time.Second).String(),
+		ReconnectAttempts: s.conn.attempts,
+	}
+	if !s.conn.disconnectedAt.IsZero() {
+		outage := now.Sub(s.conn.disconnectedAt)
+		info.DisconnectedFor = outage.Round(time.Second).String()
+		info.TotalDisconnected = (s.conn.totalDisconnected + outage).Round(time.Second).String()
+	}
+	if !s.conn.nextAttemptAt.IsZero() {
+		next := s.conn.nextAttemptAt
+		info.NextReconnectAt = &next
+	}
+	return info
+}
+
+// setConnectionState records a state transition and the time spent disconnected
+func (s *WhatsAppService) setConnectionState(state, reason string) {
+	s.conn.mu.Lock()
+	now := time.Now()
+	previous := s.conn.state
+	if previous == state && s.conn.reason == reason {
+		s.conn.mu.Unlock()
+		return
+	}
+
+	var outage time.Duration
+	switch {
+	case state == ConnectionStateConnected:
+		if !s.conn.disconnectedAt.IsZero() {
+			outage = now.Sub(s.conn.disconnectedAt)
+			s.conn.totalDisconnected += outage
+			s.conn.disconnectedAt = time.Time{}
+		}
+		s.conn.attempts = 0
+		s.conn.phone = s.ID()
+	case state != ConnectionStateConnecting && state != ConnectionStateUnpaired && s.conn.disconnectedAt.IsZero():
+		s.conn.disconnectedAt = now
+	}
+
+	s.conn.state = state
+	s.conn.since = now
+	s.conn.reason = reason
+	s.conn.mu.Unlock()
+
+	log := s.log().Info
+	if state != ConnectionStateConnected && state != ConnectionStateConnecting {
+		log = s.log().Warn
+	}
+	log("WhatsApp connection state changed",
+		"from", previous,
+		"to", state,
+		"reason", reason,
+		"outage_seconds", outage.Seconds(),
+	)
+}
+
+// handleConnectionEvent updates the connection state on connection events and
+// reconnects or alerts as needed
+func (s *WhatsAppService) handleConnectionEvent(evt interface{}) {
+	switch v := evt.(type) {
+	case *events.Connected:
+		s.setConnectionState(ConnectionStateConnected, "")
+	case *events.Disconnected:
+		s.connectionLost("connection closed by server")
+	case *events.KeepAliveTimeout:
+		// Auto reconnect of the client is disabled, so a dead connection has to be dropped here
+		if time.Since(v.LastSuccess) > whatsmeow.KeepAliveMaxFailTime {
+			s.client.Disconnect()
+			s.connectionLost(fmt.Sprintf("keepalive failed %d times", v.ErrorCount))
+		}
+	case *events.ConnectFailure:
+		s.connectionLost(fmt.Sprintf("connect failure %d: %s", v.Reason, v.Message))
+	case *events.LoggedOut:
+		s.stopReconnect()
+		s.setConnectionState(ConnectionStateLoggedOut, v.Reason.String())
+		s.sendSessionStatus(ConnectionStateLoggedOut, v.Reason.String(), nil)
+		if _, loggedOutHandler := s.hooks(); loggedOutHandler != nil {
+			loggedOutHandler(s)
+		}
+	case *events.StreamReplaced:
+		// Another client took over the session, reconnecting would kick it out again
+		s.stopReconnect()
+		s.setConnectionState(ConnectionStateStreamReplaced, "another client connected with the same session")
+		s.sendSessionStatus(ConnectionStateStreamReplaced, "another client connected with the same session", nil)
+	case *events.TemporaryBan:
+		s.setConnectionState(ConnectionStateBanned, v.String())
+		reconnectAt := s.scheduleReconnect(v.Expire)
+		s.sendSessionStatus(ConnectionStateBanned, v.String(), reconnectAt)
+	case *events.ClientOutdated:
+		s.setConnectionState(ConnectionStateClientOutdated, "WhatsApp rejected the client version, update the application")
+		reconnectAt := s.scheduleReconnect(s.reconnectCfg.ReconnectBackoffMax)
+		s.sendSessionStatus(ConnectionStateClientOutdated, "WhatsApp rejected the client version, update the application", reconnectAt)
+	}
+}
+
+// connectionLost records a lost connection and schedules a reconnect
+func (s *WhatsAppService) connectionLost(reason string) {
+	if s.ID() == "" {
+		// Unpaired devices reconnect by requesting a new login QR code
+		s.setConnectionState(ConnectionStateUnpaired, reason)
+		return
+	}
+	s.setConnectionState(ConnectionStateDisconnected, reason)
+	s.scheduleReconnect(0)
+}
+
+// scheduleReconnect reconnects after the given delay, or after the backoff of the next
+// attempt if delay is zero. Returns when the reconnect is due, nil if none was scheduled.
+func (s *WhatsAppService) scheduleReconnect(delay time.Duration) *time.Time {
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+
+	if s.conn.stopped || s.ID() == "" {
+		return nil
+	}
+	if s.conn.timer != nil {
+		s.conn.timer.Stop()
+	}
+
+	s.conn.attempts++
+	if delay <= 0 {
+		delay = s.reconnectBackoff(s.conn.attempts)
+	}
+	s.conn.nextAttemptAt = time.Now().Add(delay)
+	s.conn.timer = time.AfterFunc(delay, s.reconnect)
+
+	s.log().Info("WhatsApp reconnect scheduled",
+		"attempt", s.conn.attempts,
+		"delay_seconds", delay.Seconds(),
+	)
+
+	next := s.conn.nextAttemptAt
+	return &next
+}
+
+// reconnect connects the client again, scheduling another attempt if it fails
+func (s *WhatsAppService) reconnect() {
+	s.conn.mu.Lock()
+	s.conn.timer = nil
+	s.conn.nextAttemptAt = time.Time{}
+	stopped := s.conn.stopped
+	s.conn.mu.Unlock()
+
+	if stopped || s.ID() == "" || s.client.IsConnected() {
+		return
+	}
+
+	s.setConnectionState(ConnectionStateConnecting, "")
+	err := s.client.Connect()
+	if errors.Is(err, whatsmeow.ErrAlreadyConnected) {
+		return
+	}
+	if err != nil {
+		s.setConnectionState(ConnectionStateDisconnected, err.Error())
+		s.scheduleReconnect(0)
+	}
+}
+
+// startReconnect (re)enables reconnect supervision, e.g. after a manual connect
+func (s *WhatsAppService) startReconnect() {
+	s.conn.mu.Lock()
+	s.conn.stopped = false
+	s.conn.mu.Unlock()
+}
+
+// stopReconnect cancels any scheduled reconnect and disables supervision
+func (s *WhatsAppService) stopReconnect() {
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+
+	s.conn.stopped = true
+	if s.conn.timer != nil {
+		s.conn.timer.Stop()
+		s.conn.timer = nil
+	}
+	s.conn.nextAttemptAt = time.Time{}
+}
+
+// reconnectBackoff returns the exponential backoff with jitter before the given attempt:
+// a random duration between half and the full base * 2^(attempt-1), capped at the maximum
+func (s *WhatsAppService) reconnectBackoff(attempt int) time.Duration {
+	backoff := s.reconnectCfg.ReconnectBackoffBase
+	for i := 1; i < attempt && backoff < s.reconnectCfg.ReconnectBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > s.reconnectCfg.ReconnectBackoffMax {
+		backoff = s.reconnectCfg.ReconnectBackoffMax
+	}
+	if backoff <= 0 {
+		return time.Second
+	}
+
+	half := backoff / 2
+	return half + time.Duration(rand.Int64N(int64(half)+1))
+}
+
+// sendSessionStatus alerts Otomax (or the alert URL) about a session problem
+func (s *WhatsAppService) sendSessionStatus(status, reason string, reconnectAt *time.Time) {
+	s.conn.mu.Lock()
+	phone := s.conn.phone
+	var disconnectedSince *time.Time
+	if !s.conn.disconnectedAt.IsZero() {
+		since := s.conn.disconnectedAt
+		disconnectedSince = &since
+	}
+	s.conn.mu.Unlock()
+
+	if s.otomaxService == nil {
+		return
+	}
+
+	payload := &model.SessionStatusPayload{
+		Event:             "session_status",
+		Device:            phone,
+		Status:            status,
+		Reason:            reason,
+		DisconnectedSince: disconnectedSince,
+		ReconnectAt:       reconnectAt,
+		Timestamp:         time.Now(),
+	}
+	if err := s.otomaxService.SendSessionStatus(context.Background(), payload); err != nil {
+		s.log().Error("Failed to queue session status alert",
+			"error", err,
+			"status", status,
+		)
+	}
+}
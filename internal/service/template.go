@@ -0,0 +1,183 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"whatsapp-h2h-otomax/internal/config"
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+// defaultTemplate sends the instructions as-is, as before templates existed
+const defaultTemplate = "{{.Instructions}}"
+
+// TemplateData holds the variables available in message templates
+type TemplateData struct {
+	TrxID        string
+	Instructions string
+	Descriptions string
+	Destination  string
+	Product      string
+	Timestamp    time.Time
+}
+
+// TemplateFile represents the message templates file
+type TemplateFile struct {
+	Default      string            `json:"default"`
+	Destinations map[string]string `json:"destinations"` // Key: group JID, JID or 628xxx number
+	Products     map[string]string `json:"products"`     // Key: product code (product parameter)
+}
+
+// messageTemplates holds the parsed templates of a template file
+type messageTemplates struct {
+	defaultTemplate *template.Template
+	destinations    map[string]*template.Template
+	products        map[string]*template.Template
+}
+
+// TemplateService renders transaction messages from configurable templates
+type TemplateService struct {
+	path      string
+	mu        sync.RWMutex
+	templates *messageTemplates
+	logger    *logger.Logger
+}
+
+// NewTemplateService creates a new template service and loads the templates file.
+// Without a templates file, the instructions are sent as-is.
+func NewTemplateService(cfg *config.TemplateConfig, log *logger.Logger) (*TemplateService, error) {
+	service := &TemplateService{
+		path:   cfg.Path,
+		logger: log,
+	}
+
+	if err := service.Reload(); err != nil {
+		return nil, err
+	}
+
+	return service, nil
+}
+
+// Reload reloads the templates file; the current templates are kept if it is invalid
+func (s *TemplateService) Reload() error {
+	file := TemplateFile{}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.logger.Info("Message templates file not found, sending instructions as-is", "path", s.path)
+	} else if err != nil {
+		return fmt.Errorf("failed to read templates file: %w", err)
+	} else if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse templates file: %w", err)
+	}
+
+	templates, err := parseTemplates(&file)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.templates = templates
+	s.mu.Unlock()
+
+	s.logger.Info("Message templates loaded",
+		"path", s.path,
+		"destinations", len(templates.destinations),
+		"products", len(templates.products),
+	)
+	return nil
+}
+
+// Render renders the message of a transaction with the template of its destination,
+// falling back to the template of its product and then the default template.
+// Destination keys are the forms the destination is known by (as given, JID, phone number).
+// Returns the rendered message and the name of the template used.
+func (s *TemplateService) Render(data *TemplateData, destinationKeys ...string) (string, string, error) {
+	s.mu.RLock()
+	templates := s.templates
+	s.mu.RUnlock()
+
+	tmpl, name := templates.defaultTemplate, "default"
+	if t, ok := templates.products[data.Product]; ok && data.Product != "" {
+		tmpl, name = t, "product:"+data.Product
+	}
+	for _, key := range destinationKeys {
+		if t, ok := templates.destinations[key]; ok && key != "" {
+			tmpl, name = t, "destination:"+key
+			break
+		}
+	}
+
+	message, err := executeTemplate(tmpl, data)
+	if err != nil {
+		return "", name, err
+	}
+	return message, name, nil
+}
+
+// RenderText renders an ad-hoc template, used to try out a template before adding it to the file
+func (s *TemplateService) RenderText(text string, data *TemplateData) (string, error) {
+	tmpl, err := parseTemplate("adhoc", text)
+	if err != nil {
+		return "", err
+	}
+	return executeTemplate(tmpl, data)
+}
+
+// parseTemplates parses all templates of a templates file
+func parseTemplates(file *TemplateFile) (*messageTemplates, error) {
+	defaultText := file.Default
+	if defaultText == "" {
+		defaultText = defaultTemplate
+	}
+
+	defaultTmpl, err := parseTemplate("default", defaultText)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := &messageTemplates{
+		defaultTemplate: defaultTmpl,
+		destinations:    make(map[string]*template.Template, len(file.Destinations)),
+		products:        make(map[string]*template.Template, len(file.Products)),
+	}
+	for key, text := range file.Destinations {
+		if templates.destinations[key], err = parseTemplate("destination:"+key, text); err != nil {
+			return nil, err
+		}
+	}
+	for key, text := range file.Products {
+		if templates.products[key], err = parseTemplate("product:"+key, text); err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// parseTemplate parses a single message template
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// executeTemplate renders a template, trimming surrounding whitespace left by template actions
+func executeTemplate(tmpl *template.Template, data *TemplateData) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %w", tmpl.Name(), err)
+	}
+	message := strings.TrimSpace(sb.String())
+	if message == "" {
+		return "", fmt.Errorf("failed to render template %s: rendered message is empty", tmpl.Name())
+	}
+	return message, nil
+}
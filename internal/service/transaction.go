@@ -2,9 +2,15 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	"go.mau.fi/whatsmeow/types"
+
 	"whatsapp-h2h-otomax/internal/config"
 	"whatsapp-h2h-otomax/internal/model"
 	"whatsapp-h2h-otomax/internal/repository"
@@ -13,33 +19,95 @@ import (
 
 // TransactionService handles transaction processing
 type TransactionService struct {
-	whatsappService *WhatsAppService
+	sessions        *SessionPool
+	otomaxService   *OtomaxService
+	mediaService    *MediaService
+	templates       *TemplateService
+	scheduler       *SendScheduler
 	repo            *repository.TransactionRepository
+	messages        *repository.MessageRepository
+	webhooks        *repository.WebhookRepository
+	outbound        *repository.OutboundRepository
+	outboundCfg     *config.OutboundQueueConfig
+	outboundWake    chan struct{}
 	ttl             time.Duration
+	retention       time.Duration
+	idempotent      bool
 	logger          *logger.Logger
 }
 
 // NewTransactionService creates a new transaction service
-func NewTransactionService(waService *WhatsAppService, cfg *config.MessageTrackingConfig, log *logger.Logger) (*TransactionService, error) {
+func NewTransactionService(sessions *SessionPool, scheduler *SendScheduler, cfg *config.MessageTrackingConfig, log *logger.Logger) (*TransactionService, error) {
 	// Initialize repository
 	repo, err := repository.NewTransactionRepository(cfg.TrackingDBPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize transaction repository: %w", err)
 	}
 
+	outbound, err := repository.NewOutboundRepository(repo.DB())
+	if err != nil {
+		repo.Close()
+		return nil, fmt.Errorf("failed to initialize outbound queue repository: %w", err)
+	}
+
 	service := &TransactionService{
-		whatsappService: waService,
+		sessions:        sessions,
+		scheduler:       scheduler,
 		repo:            repo,
+		outbound:        outbound,
+		outboundWake:    make(chan struct{}, 1),
 		ttl:             cfg.TTL,
+		retention:       cfg.Retention,
+		idempotent:      cfg.IdempotentForward,
 		logger:          log,
 	}
 
-	// Start cleanup goroutine
+	// Sends interrupted by a crash or shutdown left their TrxID reserved
+	if count, err := repo.FailInterrupted("send interrupted by application stop, the message may or may not have been sent"); err != nil {
+		log.Error("Failed to release interrupted transactions", "error", err)
+	} else if count > 0 {
+		log.Warn("Interrupted transactions marked as failed", "count", count)
+	}
+
+	// Start expiry and retention goroutine
 	go service.cleanupExpiredPeriodically()
 
 	return service, nil
 }
 
+// SetOtomaxService sets the Otomax service for transaction status reports
+func (s *TransactionService) SetOtomaxService(otomaxService *OtomaxService) {
+	s.otomaxService = otomaxService
+}
+
+// SetMediaService sets the media service used to fetch media attached by URL
+func (s *TransactionService) SetMediaService(mediaService *MediaService) {
+	s.mediaService = mediaService
+}
+
+// SetTemplateService sets the templates used to format transaction messages
+func (s *TransactionService) SetTemplateService(templates *TemplateService) {
+	s.templates = templates
+}
+
+// SetMessageRepository sets the message log shown for a transaction and purged with it
+func (s *TransactionService) SetMessageRepository(messages *repository.MessageRepository) {
+	s.messages = messages
+}
+
+// SetWebhookRepository sets the webhook outbox whose finished deliveries are purged with transactions
+func (s *TransactionService) SetWebhookRepository(webhooks *repository.WebhookRepository) {
+	s.webhooks = webhooks
+}
+
+// MaxMediaSize returns the maximum size in bytes of media attached to a transaction
+func (s *TransactionService) MaxMediaSize() int64 {
+	if s.mediaService == nil {
+		return 0
+	}
+	return s.mediaService.MaxSize()
+}
+
 // Close closes the transaction service and database connection
 func (s *TransactionService) Close() error {
 	return s.repo.Close()
@@ -47,82 +115,446 @@ func (s *TransactionService) Close() error {
 
 // ProcessTransaction processes transaction and sends to WhatsApp
 func (s *TransactionService) ProcessTransaction(ctx context.Context, req *model.TransactionRequest) (*model.TransactionData, error) {
-	// Check if transaction already exists (duplicate prevention)
-	existingTrx, err := s.repo.GetByTrxID(req.TrxID)
+	// Check if transaction already exists (duplicate prevention); a retry
+	// with the same content gets the result of the first request
+	hash := contentHash(req)
+	if replay, err := s.checkDuplicate(req, hash); err != nil || replay != nil {
+		return replay, err
+	}
+
+	// Format message
+	message, _, err := s.RenderMessage(req, "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to check existing transaction: %w", err)
+		return nil, err
+	}
+
+	// Async mode: persist to outbound queue, sent in background
+	if req.Async {
+		if req.Media != nil || req.MediaURL != "" {
+			return nil, fmt.Errorf("%w: attachments are not supported in async mode", ErrInvalidMedia)
+		}
+		return s.enqueueTransaction(req, message, hash)
 	}
-	if existingTrx != nil {
-		return nil, fmt.Errorf("duplicate transaction: TrxID '%s' already exists and is still being tracked (sent at %s)", req.TrxID, existingTrx.SentAt.Format(time.RFC3339))
+
+	// Choose the sender device
+	session, err := s.sessions.Route(req.Sender, req.Destination, req.Product)
+	if err != nil {
+		return nil, err
 	}
 
 	// Validate destination
-	jid, destType, err := s.whatsappService.ValidateDestination(req.Destination)
+	jid, destType, err := session.ValidateDestination(req.Destination)
 	if err != nil {
-		return nil, fmt.Errorf("invalid destination: %w", err)
+		return nil, err
 	}
 
-	// Format message
-	message := req.Instructions;
+	// Download media attached by URL
+	if req.Media == nil && req.MediaURL != "" {
+		if s.mediaService == nil {
+			return nil, fmt.Errorf("%w: media attachments are not enabled", ErrInvalidMedia)
+		}
+		req.Media, err = s.mediaService.Fetch(ctx, req.MediaURL, req.MediaType)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	// Send message to WhatsApp
-	messageID, err := s.whatsappService.SendMessage(ctx, jid, message)
+	return s.sendTransaction(ctx, session, req.TrxID, req.APIKey, jid, destType, message, hash, req.Media)
+}
+
+// checkDuplicate returns an error if the TrxID is still tracked or waiting in the outbound queue.
+// In idempotent mode a request with the same destination and content is not a duplicate
+// but a retry, and the result of the first request is returned instead.
+func (s *TransactionService) checkDuplicate(req *model.TransactionRequest, hash string) (*model.TransactionData, error) {
+	// Expired transactions are kept for audit until retention, their TrxID stays taken
+	existingTrx, err := s.repo.FindByTrxID(req.TrxID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send message: %w", err)
+		return nil, fmt.Errorf("failed to check existing transaction: %w", err)
+	}
+	if existingTrx != nil && existingTrx.Status == repository.TransactionStatusPending {
+		// A retry while the first request still waits for the rate limiter or WhatsApp
+		if s.isRetry(existingTrx.Destination, existingTrx.ContentHash, req, hash) {
+			s.logger.WithTrxID(req.TrxID).WithAPIKey(req.APIKey).Info("Transaction retry, first request still sending",
+				"started_at", existingTrx.SentAt,
+			)
+			return &model.TransactionData{
+				TrxID:            existingTrx.TrxID,
+				Destination:      existingTrx.Destination,
+				DestinationType:  existingTrx.DestinationType,
+				Sender:           existingTrx.Sender,
+				Timestamp:        existingTrx.SentAt,
+				Status:           repository.TransactionStatusPending,
+				Delivery:         existingTrx.Delivery,
+				IdempotentReplay: true,
+			}, nil
+		}
+		return nil, fmt.Errorf("%w: TrxID '%s' is currently being sent (started at %s)%s",
+			ErrDuplicateTransaction, req.TrxID, existingTrx.SentAt.Format(time.RFC3339), s.conflictDetail())
+	}
+	// A failed send can be retried with the same TrxID
+	if existingTrx != nil && existingTrx.Status != repository.TransactionStatusFailed {
+		if s.isRetry(existingTrx.Destination, existingTrx.ContentHash, req, hash) {
+			s.logger.WithTrxID(req.TrxID).WithAPIKey(req.APIKey).Info("Transaction retry, returning original result",
+				"message_id", existingTrx.MessageID,
+			)
+			return &model.TransactionData{
+				TrxID:            existingTrx.TrxID,
+				Destination:      existingTrx.Destination,
+				DestinationType:  existingTrx.DestinationType,
+				Sender:           existingTrx.Sender,
+				MessageID:        existingTrx.MessageID,
+				Timestamp:        existingTrx.SentAt,
+				Status:           repository.OutboundStatusSent,
+				Delivery:         existingTrx.Delivery,
+				MediaType:        existingTrx.MediaType,
+				IdempotentReplay: true,
+			}, nil
+		}
+		if !existingTrx.ExpiresAt.After(time.Now()) {
+			return nil, fmt.Errorf("%w: TrxID '%s' was already used (sent at %s) and is kept until the transaction retention ends%s",
+				ErrDuplicateTransaction, req.TrxID, existingTrx.SentAt.Format(time.RFC3339), s.conflictDetail())
+		}
+		return nil, fmt.Errorf("%w: TrxID '%s' already exists and is still being tracked (sent at %s)%s",
+			ErrDuplicateTransaction, req.TrxID, existingTrx.SentAt.Format(time.RFC3339), s.conflictDetail())
 	}
 
-	// Save transaction to database
-	now := time.Now()
+	queued, err := s.outbound.GetByTrxID(req.TrxID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check outbound queue: %w", err)
+	}
+	if queued != nil && (queued.Status == repository.OutboundStatusPending || queued.Status == repository.OutboundStatusSending) {
+		if s.isRetry(queued.Destination, queued.ContentHash, req, hash) {
+			s.logger.WithTrxID(req.TrxID).WithAPIKey(req.APIKey).Info("Transaction retry, already queued for delivery",
+				"queue_id", queued.ID,
+			)
+			return &model.TransactionData{
+				TrxID:            queued.TrxID,
+				Destination:      queued.Destination,
+				Sender:           queued.Sender,
+				Timestamp:        queued.CreatedAt,
+				Status:           repository.OutboundStatusPending,
+				Delivery:         DeliveryAsync,
+				IdempotentReplay: true,
+			}, nil
+		}
+		return nil, fmt.Errorf("%w: TrxID '%s' is already queued for delivery (queued at %s)%s",
+			ErrDuplicateTransaction, req.TrxID, queued.CreatedAt.Format(time.RFC3339), s.conflictDetail())
+	}
+
+	return nil, nil
+}
+
+// isRetry reports whether a request repeats a stored transaction: idempotent mode is on
+// and both have the same destination and content. Records saved without hash never match.
+func (s *TransactionService) isRetry(destination, storedHash string, req *model.TransactionRequest, hash string) bool {
+	if !s.idempotent || storedHash == "" || storedHash != hash {
+		return false
+	}
+	if destination == req.Destination {
+		return true
+	}
+
+	// Tracked records store the destination as JID
+	stored, _, err := parseDestination(destination)
+	if err != nil {
+		return false
+	}
+	requested, _, err := parseDestination(req.Destination)
+	return err == nil && stored == requested
+}
+
+// conflictDetail explains a duplicate error in idempotent mode
+func (s *TransactionService) conflictDetail() string {
+	if !s.idempotent {
+		return ""
+	}
+	return " with a different destination or content"
+}
+
+// contentHash returns a hash of the content of a transaction request, used to recognize retries.
+// The destination is compared separately since it is stored normalized.
+func contentHash(req *model.TransactionRequest) string {
+	h := sha256.New()
+	for _, field := range []string{req.Descriptions, req.Instructions, req.Product, req.MediaURL, req.MediaType} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	if req.Media != nil {
+		h.Write([]byte(req.Media.Type))
+		h.Write([]byte{0})
+		h.Write(req.Media.Data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sendTransaction reserves the TrxID, sends the message (with optional media, using the
+// message as caption) from a device through the rate limiter and completes the tracking record.
+// The record is tagged with the name of the API key that forwarded the transaction.
+func (s *TransactionService) sendTransaction(ctx context.Context, session *WhatsAppService, trxID, apiKey string, jid types.JID, destType, message, hash string, media *model.TransactionMedia) (*model.TransactionData, error) {
+	log := s.logger.WithTrxID(trxID).WithAPIKey(apiKey)
+
+	// Reserve the TrxID first, so concurrent requests can't both send it
 	record := &repository.TransactionRecord{
-		TrxID:           req.TrxID,
-		MessageID:       messageID,
+		TrxID:           trxID,
 		Destination:     jid.String(),
 		DestinationType: destType,
-		SentAt:          now,
-		ExpiresAt:       now.Add(s.ttl),
+		Sender:          session.ID(),
+		ExpiresAt:       time.Now().Add(s.ttl),
+		ContentHash:     hash,
+		APIKey:          apiKey,
+	}
+	reserved, err := s.repo.Reserve(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve transaction: %w", err)
+	}
+	if !reserved {
+		return nil, fmt.Errorf("%w: TrxID '%s' is already being sent or tracked", ErrDuplicateTransaction, trxID)
+	}
+
+	// Send message to WhatsApp through the rate limiter
+	messageID, schedule, err := s.scheduler.Send(ctx, jid.String(), func(ctx context.Context) (string, error) {
+		if media != nil {
+			return session.SendMedia(ctx, jid, media, message, trxID)
+		}
+		return session.SendMessage(ctx, jid, message, trxID)
+	})
+	if err != nil {
+		if markErr := s.repo.MarkFailed(record.ID, err.Error()); markErr != nil {
+			log.Error("Failed to release transaction reservation", "error", markErr)
+		}
+		if errors.Is(err, ErrSendQueueFull) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrSendFailed, err)
+	}
+
+	// Complete the reservation with the message ID
+	now := time.Now()
+	record.MessageID = messageID
+	record.SentAt = now
+	record.ExpiresAt = now.Add(s.ttl)
+	record.Delivery = schedule.Delivery
+	if media != nil {
+		record.MediaType = media.Type
 	}
-	if err := s.repo.Save(record); err != nil {
+	if err := s.repo.MarkSent(record); err != nil {
 		// Log error but don't fail the request (message already sent)
-		s.logger.WithTrxID(req.TrxID).Error("Failed to save transaction to database", "error", err)
+		log.Error("Failed to save transaction to database", "error", err)
 	}
 
 	// Get current count for logging
 	count, _ := s.repo.Count()
 
 	// Log successful transaction
-	s.logger.WithTrxID(req.TrxID).Info("Transaction sent",
+	log.Info("Transaction sent",
 		"destination", jid.String(),
 		"type", destType,
+		"sender", session.ID(),
 		"message_id", messageID,
 		"tracker_count", count,
+		"delivery", schedule.Delivery,
+		"queue_position", schedule.QueuePosition,
+		"queue_wait_ms", schedule.Waited.Milliseconds(),
+		"has_media", media != nil,
 	)
 
-	return &model.TransactionData{
-		TrxID:           req.TrxID,
+	data := &model.TransactionData{
+		TrxID:           trxID,
 		Destination:     jid.String(),
 		DestinationType: destType,
+		Sender:          session.ID(),
 		MessageID:       messageID,
 		Timestamp:       now,
-	}, nil
+		Status:          repository.OutboundStatusSent,
+		Delivery:        schedule.Delivery,
+		QueuePosition:   schedule.QueuePosition,
+	}
+	if media != nil {
+		data.MediaType = media.Type
+	}
+	return data, nil
+}
+
+// GetTransactionDetail returns the tracked state of a transaction, including expired
+// records that are still retained. Returns nil if the TrxID is unknown.
+func (s *TransactionService) GetTransactionDetail(trxID string) (*model.TransactionDetail, error) {
+	record, err := s.repo.FindByTrxID(trxID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction: %w", err)
+	}
+	queued, err := s.outbound.GetByTrxID(trxID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbound queue entry: %w", err)
+	}
+	if record == nil && queued == nil {
+		return nil, nil
+	}
+
+	detail := &model.TransactionDetail{
+		TrxID:   trxID,
+		Replies: []model.TransactionReply{},
+	}
+
+	if record != nil {
+		detail.MessageID = record.MessageID
+		detail.Destination = record.Destination
+		detail.DestinationType = record.DestinationType
+		detail.Sender = record.Sender
+		detail.SentAt = &record.SentAt
+		detail.ExpiresAt = &record.ExpiresAt
+		detail.DeliveredAt = record.DeliveredAt
+		detail.ReadAt = record.ReadAt
+		detail.RepliedAt = record.RepliedAt
+		detail.Status = record.Status
+		detail.APIKey = record.APIKey
+		detail.Expired = !record.ExpiresAt.After(time.Now())
+		detail.Delivery = model.DeliveryState{
+			Status:    repository.OutboundStatusSent,
+			Mode:      "sync",
+			LastError: record.LastError,
+		}
+		switch record.Status {
+		case repository.TransactionStatusPending:
+			detail.Delivery.Status = repository.OutboundStatusSending
+		case repository.TransactionStatusFailed:
+			detail.Delivery.Status = repository.OutboundStatusFailed
+		}
+	}
+
+	if queued != nil {
+		if detail.Destination == "" {
+			detail.Destination = queued.Destination
+		}
+		if detail.Sender == "" {
+			detail.Sender = queued.Sender
+		}
+		if detail.APIKey == "" {
+			detail.APIKey = queued.APIKey
+		}
+		if detail.Status == "" {
+			detail.Status = repository.TransactionStatusPending
+			if queued.Status == repository.OutboundStatusFailed {
+				detail.Status = repository.TransactionStatusFailed
+			}
+		}
+		detail.Delivery = model.DeliveryState{
+			Status:    queued.Status,
+			Mode:      DeliveryAsync,
+			Attempts:  queued.Attempts,
+			LastError: queued.LastError,
+			QueuedAt:  &queued.CreatedAt,
+		}
+	}
+
+	if s.otomaxService != nil {
+		replies, err := s.getReplies(trxID)
+		if err != nil {
+			return nil, err
+		}
+		detail.Replies = replies
+	}
+
+	return detail, nil
 }
 
-// formatMessage formats the transaction message
-// func (s *TransactionService) formatMessage(req *model.TransactionRequest) string {
-// 	return fmt.Sprintf(
-// 		"🔔 TRANSAKSI BARU\n"+
-// 			"━━━━━━━━━━━━━━━━\n"+
-// 			"TRX ID: %s\n"+
-// 			"Tujuan:\n%s\n\n"+
-// 			"Catatan:\n%s\n",
-// 		req.TrxID,
-// 		req.Instructions,
-// 		req.Descriptions,
-// 	)
-// }
+// GetTransactionMessages returns the messages sent and received for a transaction, oldest first.
+// Returns nil if the TrxID is unknown.
+func (s *TransactionService) GetTransactionMessages(trxID string) ([]*repository.MessageRecord, error) {
+	if s.messages == nil {
+		return nil, fmt.Errorf("message log not configured")
+	}
+	messages, err := s.messages.ListByTrxID(trxID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	if len(messages) > 0 {
+		return messages, nil
+	}
 
-// GetTransactionByDestination retrieves transaction info by destination JID
-func (s *TransactionService) GetTransactionByDestination(destination string) (*repository.TransactionRecord, error) {
-	return s.repo.GetByDestination(destination)
+	// Transactions sent before the message log existed, or not sent yet, have no messages
+	detail, err := s.GetTransactionDetail(trxID)
+	if err != nil || detail == nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// getReplies returns the replies forwarded to Otomax for a transaction, oldest first
+func (s *TransactionService) getReplies(trxID string) ([]model.TransactionReply, error) {
+	deliveries, err := s.otomaxService.ListDeliveries(repository.WebhookFilter{
+		TrxID: trxID,
+		Event: "message_received",
+		Limit: 500,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replies: %w", err)
+	}
+
+	replies := make([]model.TransactionReply, 0, len(deliveries))
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		delivery := deliveries[i]
+
+		var payload model.WebhookPayload
+		if err := json.Unmarshal([]byte(delivery.Payload), &payload); err != nil {
+			s.logger.WithTrxID(trxID).Warn("Failed to decode stored webhook payload",
+				"error", err,
+				"delivery_id", delivery.ID,
+			)
+			continue
+		}
+
+		replies = append(replies, model.TransactionReply{
+			Sender:        payload.Sender,
+			Message:       payload.Message,
+			Context:       payload.Context,
+			WebhookStatus: delivery.Status,
+			WebhookID:     delivery.ID,
+		})
+	}
+	return replies, nil
+}
+
+// RenderMessage formats the message of a transaction with the template of its
+// destination or product, or with the given ad-hoc template text.
+// Returns the message and the name of the template used.
+func (s *TransactionService) RenderMessage(req *model.TransactionRequest, templateText string) (string, string, error) {
+	if s.templates == nil {
+		return req.Instructions, "none", nil
+	}
+
+	data := &TemplateData{
+		TrxID:        req.TrxID,
+		Instructions: req.Instructions,
+		Descriptions: req.Descriptions,
+		Destination:  req.Destination,
+		Product:      req.Product,
+		Timestamp:    time.Now(),
+	}
+
+	if templateText != "" {
+		message, err := s.templates.RenderText(templateText, data)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+		}
+		return message, "adhoc", nil
+	}
+
+	// Templates may be keyed by the destination as given, its JID or phone number
+	keys := []string{req.Destination}
+	if jid, _, err := s.sessions.ParseDestination(req.Destination); err == nil {
+		keys = append(keys, jid.String(), jid.User)
+	}
+
+	message, name, err := s.templates.Render(data, keys...)
+	if err != nil {
+		return "", name, fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+	}
+	return message, name, nil
+}
+
+// GetTransactionByDestination retrieves the latest transaction a sender device sent to a destination JID
+func (s *TransactionService) GetTransactionByDestination(sender, destination string) (*repository.TransactionRecord, error) {
+	return s.repo.GetByDestination(sender, destination)
 }
 
 // GetRepository returns the transaction repository
@@ -130,17 +562,54 @@ func (s *TransactionService) GetRepository() *repository.TransactionRepository {
 	return s.repo
 }
 
-// cleanupExpiredPeriodically runs cleanup every hour
+// cleanupExpiredPeriodically marks expired transactions and purges the ones past retention every hour
 func (s *TransactionService) cleanupExpiredPeriodically() {
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		count, err := s.repo.CleanupExpired()
+		count, err := s.repo.MarkExpired()
+		if err != nil {
+			s.logger.Error("Failed to mark expired transactions", "error", err)
+		} else if count > 0 {
+			s.logger.Info("Marked transactions as expired", "count", count)
+		}
+
+		if s.retention <= 0 {
+			continue
+		}
+		before := time.Now().Add(-s.retention)
+		count, err = s.repo.PurgeBefore(before)
+		if err != nil {
+			s.logger.Error("Failed to purge old transactions", "error", err)
+		} else if count > 0 {
+			s.logger.Info("Purged transactions past retention", "count", count)
+		}
+
+		count, err = s.outbound.PurgeBefore(before)
+		if err != nil {
+			s.logger.Error("Failed to purge old outbound queue entries", "error", err)
+		} else if count > 0 {
+			s.logger.Info("Purged sent and failed outbound queue entries past retention", "count", count)
+		}
+
+		if s.webhooks != nil {
+			count, err = s.webhooks.PurgeBefore(before)
+			if err != nil {
+				s.logger.Error("Failed to purge old webhook deliveries", "error", err)
+			} else if count > 0 {
+				s.logger.Info("Purged finished webhook deliveries past retention", "count", count)
+			}
+		}
+
+		if s.messages == nil {
+			continue
+		}
+		count, err = s.messages.PurgeBefore(before)
 		if err != nil {
-			s.logger.Error("Failed to cleanup expired transactions", "error", err)
+			s.logger.Error("Failed to purge old messages", "error", err)
 		} else if count > 0 {
-			s.logger.Info("Cleaned up expired transactions", "count", count)
+			s.logger.Info("Purged messages past retention", "count", count)
 		}
 	}
 }
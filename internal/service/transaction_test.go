@@ -0,0 +1,159 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"whatsapp-h2h-otomax/internal/model"
+	"whatsapp-h2h-otomax/internal/repository"
+	"whatsapp-h2h-otomax/pkg/logger"
+)
+
+// newTestTransactionService creates a transaction service on a temporary tracking
+// database, without WhatsApp sessions and background workers
+func newTestTransactionService(t *testing.T, idempotent bool) *TransactionService {
+	t.Helper()
+	repo, err := repository.NewTransactionRepository(filepath.Join(t.TempDir(), "tracking.db"))
+	if err != nil {
+		t.Fatalf("failed to open tracking database: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	outbound, err := repository.NewOutboundRepository(repo.DB())
+	if err != nil {
+		t.Fatalf("failed to open outbound queue: %v", err)
+	}
+
+	return &TransactionService{
+		repo:       repo,
+		outbound:   outbound,
+		ttl:        time.Hour,
+		idempotent: idempotent,
+		logger:     logger.New("error"),
+	}
+}
+
+func TestCheckDuplicate(t *testing.T) {
+	original := &model.TransactionRequest{
+		TrxID:        "TRX1",
+		Destination:  "081234567890",
+		Descriptions: "Pesanan baru",
+		Instructions: "Mohon diproses",
+	}
+	changed := *original
+	changed.Instructions = "Mohon diproses segera"
+	otherDestination := *original
+	otherDestination.Destination = "081234567891"
+	sameChatAsJID := *original
+	sameChatAsJID.Destination = "6281234567890@s.whatsapp.net"
+
+	// Existing states of TRX1, created with the original request
+	pending := func(t *testing.T, s *TransactionService) {
+		reserveTransaction(t, s, original)
+	}
+	sent := func(t *testing.T, s *TransactionService) {
+		record := reserveTransaction(t, s, original)
+		record.MessageID = "3EB0A"
+		record.Delivery = DeliveryImmediate
+		if err := s.repo.MarkSent(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expired := func(t *testing.T, s *TransactionService) {
+		record := reserveTransaction(t, s, original)
+		record.MessageID = "3EB0A"
+		record.ExpiresAt = time.Now().Add(-time.Minute)
+		if err := s.repo.MarkSent(record); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.repo.MarkExpired(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	failed := func(t *testing.T, s *TransactionService) {
+		record := reserveTransaction(t, s, original)
+		if err := s.repo.MarkFailed(record.ID, "send failed"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	queued := func(t *testing.T, s *TransactionService) {
+		record := &repository.OutboundRecord{
+			TrxID:       original.TrxID,
+			Destination: original.Destination,
+			Message:     "message",
+			ContentHash: contentHash(original),
+		}
+		if ok, err := s.outbound.Enqueue(record); err != nil || !ok {
+			t.Fatalf("Enqueue() = %v, %v", ok, err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		idempotent bool
+		existing   func(t *testing.T, s *TransactionService)
+		req        *model.TransactionRequest
+		wantErr    error
+		wantReplay string // Status of the replayed result, empty if no replay
+	}{
+		{"new TrxID", true, nil, original, nil, ""},
+		{"retry while the first request is sending", true, pending, original, nil, repository.TransactionStatusPending},
+		{"other content while sending", true, pending, &changed, ErrDuplicateTransaction, ""},
+		{"retry after sent", true, sent, original, nil, repository.OutboundStatusSent},
+		{"retry with the destination as JID", true, sent, &sameChatAsJID, nil, repository.OutboundStatusSent},
+		{"other content after sent", true, sent, &changed, ErrDuplicateTransaction, ""},
+		{"other destination after sent", true, sent, &otherDestination, ErrDuplicateTransaction, ""},
+		{"retry after expired", true, expired, original, nil, repository.OutboundStatusSent},
+		{"other content after expired", true, expired, &changed, ErrDuplicateTransaction, ""},
+		{"expired, idempotency off", false, expired, original, ErrDuplicateTransaction, ""},
+		{"failed send can be retried", true, failed, &changed, nil, ""},
+		{"retry while queued", true, queued, original, nil, repository.OutboundStatusPending},
+		{"other content while queued", true, queued, &changed, ErrDuplicateTransaction, ""},
+		{"retry while sending, idempotency off", false, pending, original, ErrDuplicateTransaction, ""},
+		{"retry after sent, idempotency off", false, sent, original, ErrDuplicateTransaction, ""},
+		{"retry while queued, idempotency off", false, queued, original, ErrDuplicateTransaction, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestTransactionService(t, tt.idempotent)
+			if tt.existing != nil {
+				tt.existing(t, s)
+			}
+
+			replay, err := s.checkDuplicate(tt.req, contentHash(tt.req))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("checkDuplicate() error = %v, want %v", err, tt.wantErr)
+			}
+			switch {
+			case tt.wantReplay == "" && replay != nil:
+				t.Errorf("checkDuplicate() replayed %+v, want none", replay)
+			case tt.wantReplay != "" && replay == nil:
+				t.Errorf("checkDuplicate() = nil, want replay with status %s", tt.wantReplay)
+			case replay != nil && (replay.Status != tt.wantReplay || !replay.IdempotentReplay || replay.TrxID != tt.req.TrxID):
+				t.Errorf("checkDuplicate() replayed %+v, want status %s", replay, tt.wantReplay)
+			}
+		})
+	}
+}
+
+// reserveTransaction reserves the TrxID of a request like sendTransaction does
+func reserveTransaction(t *testing.T, s *TransactionService, req *model.TransactionRequest) *repository.TransactionRecord {
+	t.Helper()
+	jid, destType, err := parseDestination(req.Destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := &repository.TransactionRecord{
+		TrxID:           req.TrxID,
+		Destination:     jid.String(),
+		DestinationType: destType,
+		ExpiresAt:       time.Now().Add(s.ttl),
+		ContentHash:     contentHash(req),
+	}
+	if ok, err := s.repo.Reserve(record); err != nil || !ok {
+		t.Fatalf("Reserve() = %v, %v", ok, err)
+	}
+	return record
+}
@@ -2,70 +2,113 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.mau.fi/whatsmeow"
-	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/store"
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 	waProto "go.mau.fi/whatsmeow/binary/proto"
 	waLog "go.mau.fi/whatsmeow/util/log"
-	qrcode "github.com/skip2/go-qrcode"
+	"google.golang.org/protobuf/proto"
 
 	"whatsapp-h2h-otomax/internal/config"
+	"whatsapp-h2h-otomax/internal/metrics"
 	"whatsapp-h2h-otomax/internal/model"
 	"whatsapp-h2h-otomax/internal/repository"
 	"whatsapp-h2h-otomax/pkg/logger"
 )
 
-// WhatsAppService handles WhatsApp operations
+// ErrAlreadyLoggedIn is returned when a login is requested for a device that is already paired
+var ErrAlreadyLoggedIn = errors.New("device is already logged in")
+
+// ErrNotLoggedIn is returned when a device that is not paired is logged out
+var ErrNotLoggedIn = errors.New("device is not logged in")
+
+// loginCodeWait bounds the wait for the first QR code of a new login
+const loginCodeWait = 10 * time.Second
+
+// WhatsAppService handles WhatsApp operations of a single linked device (sender number)
 type WhatsAppService struct {
-	client            *whatsmeow.Client
-	container         *sqlstore.Container
-	logger            *logger.Logger
-	otomaxService     *OtomaxService
-	repo              *repository.TransactionRepository
-	webhookWhitelist  []string
+	client           *whatsmeow.Client
+	baseLogger       *logger.Logger
+	logger           atomic.Pointer[logger.Logger] // Tagged with the device, replaced on pairing
+	otomaxService    *OtomaxService
+	mediaService     *MediaService
+	repo             *repository.TransactionRepository
+	messages         *repository.MessageRepository
+	webhookWhitelist []string
+	reconnectCfg     *config.WhatsAppConfig
+	login            loginState
+	conn             connectionState
+
+	// Hooks may be registered while event handlers run
+	hooksMu           sync.RWMutex
+	connectedHandlers []func()
+	loggedOutHandler  func(*WhatsAppService)
 }
 
-// NewWhatsAppService creates a new WhatsApp service
-func NewWhatsAppService(cfg *config.WhatsAppConfig, log *logger.Logger) (*WhatsAppService, error) {
-	ctx := context.Background()
-	
-	// Ensure database directory exists
-	dbDir := filepath.Dir(cfg.DBPath)
-	if err := os.MkdirAll(dbDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create database directory: %w", err)
-	}
-	
-	log.Info("Database directory ready", "path", dbDir)
-	
-	// Setup database for session storage
-	container, err := sqlstore.New(ctx, "sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on", cfg.DBPath), waLog.Noop)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create store: %w", err)
+// loginState holds the progress of the QR code login of an unpaired device
+type loginState struct {
+	mu        sync.Mutex
+	active    bool
+	code      string
+	expiresAt time.Time
+	lastEvent string
+	codeReady chan struct{} // Closed when the first QR code of the login is emitted
+}
+
+// newWhatsAppService creates a WhatsApp service for a device of the session store
+func newWhatsAppService(device *store.Device, cfg *config.WhatsAppConfig, log *logger.Logger) *WhatsAppService {
+	// Create WhatsApp client; reconnects are supervised by the service with backoff
+	client := whatsmeow.NewClient(device, waLog.Noop)
+	client.EnableAutoReconnect = false
+
+	service := &WhatsAppService{
+		client:       client,
+		baseLogger:   log,
+		reconnectCfg: cfg,
 	}
+	service.logger.Store(log.WithDevice(service.deviceName()))
 
-	// Get first device or create new one
-	deviceStore, err := container.GetFirstDevice(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get device: %w", err)
+	service.conn.state = ConnectionStateDisconnected
+	if device.ID == nil {
+		service.conn.state = ConnectionStateUnpaired
 	}
+	service.conn.since = time.Now()
+	service.conn.phone = service.ID()
 
-	// Create WhatsApp client
-	client := whatsmeow.NewClient(deviceStore, waLog.Noop)
+	// Register event handler
+	client.AddEventHandler(service.handleEvent)
 
-	service := &WhatsAppService{
-		client:    client,
-		container: container,
-		logger:    log,
+	return service
+}
+
+// ID returns the phone number of the linked device, or empty if not paired yet
+func (s *WhatsAppService) ID() string {
+	if s.client.Store.ID == nil {
+		return ""
+	}
+	return s.client.Store.ID.User
+}
+
+// deviceName returns the name used for the device in logs
+func (s *WhatsAppService) deviceName() string {
+	if id := s.ID(); id != "" {
+		return id
 	}
+	return "unpaired"
+}
 
-	return service, nil
+// log returns the logger of the device
+func (s *WhatsAppService) log() *logger.Logger {
+	return s.logger.Load()
 }
 
 // SetOtomaxService sets the Otomax service for webhook delivery
@@ -73,206 +116,240 @@ func (s *WhatsAppService) SetOtomaxService(otomaxService *OtomaxService) {
 	s.otomaxService = otomaxService
 }
 
+// SetMediaService sets the media service used to store received media
+func (s *WhatsAppService) SetMediaService(mediaService *MediaService) {
+	s.mediaService = mediaService
+}
+
 // SetTransactionRepository sets the transaction repository for tracking
 func (s *WhatsAppService) SetTransactionRepository(repo *repository.TransactionRepository) {
 	s.repo = repo
 }
 
+// SetMessageRepository sets the repository logging the messages of transactions
+func (s *WhatsAppService) SetMessageRepository(messages *repository.MessageRepository) {
+	s.messages = messages
+}
+
 // SetWebhookWhitelist sets the whitelist of JIDs/Groups allowed for webhook
 func (s *WhatsAppService) SetWebhookWhitelist(whitelist []string) {
 	s.webhookWhitelist = whitelist
 }
 
-// Connect connects to WhatsApp
+// AddConnectedHandler registers a callback run every time the client (re)connects
+func (s *WhatsAppService) AddConnectedHandler(handler func()) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.connectedHandlers = append(s.connectedHandlers, handler)
+}
+
+// setHooks replaces the callbacks run when the client connects and when the device is logged out
+func (s *WhatsAppService) setHooks(connected []func(), loggedOut func(*WhatsAppService)) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.connectedHandlers = connected
+	s.loggedOutHandler = loggedOut
+}
+
+// hooks returns the callbacks run when the client connects and when the device is logged out
+func (s *WhatsAppService) hooks() ([]func(), func(*WhatsAppService)) {
+	s.hooksMu.RLock()
+	defer s.hooksMu.RUnlock()
+	return s.connectedHandlers, s.loggedOutHandler
+}
+
+// Connect connects to WhatsApp. A device that is not paired yet starts the
+// QR code login flow in the background and returns right away; the QR code
+// is then available through LoginQR and the pairing code through PairPhone.
 func (s *WhatsAppService) Connect() error {
 	// Check if we have a logged in session
 	if s.client.Store.ID == nil {
-		// No logged in session, need to pair with QR code
-		s.logger.Info("No logged in session found, starting QR code pairing...")
-		return s.connectWithEventLogin()
+		s.log().Info("No logged in session found, waiting for pairing via QR code or pairing code")
+		return s.StartLogin()
 	}
-	
+
 	// We have a session, just connect
-	s.logger.Info("Existing session found, connecting...")
-	
-	// Register event handler
-	s.client.AddEventHandler(s.handleEvent)
-	
+	s.log().Info("Existing session found, connecting...")
+	s.startReconnect()
+	s.setConnectionState(ConnectionStateConnecting, "")
+
 	err := s.client.Connect()
 	if err != nil {
+		// Keep trying in the background
+		s.setConnectionState(ConnectionStateDisconnected, err.Error())
+		s.scheduleReconnect(0)
 		return fmt.Errorf("failed to connect: %w", err)
 	}
 
-	s.logger.Info("WhatsApp client connected successfully")
+	s.log().Info("WhatsApp client connected successfully")
 	return nil
 }
 
-// connectWithEventLogin is event-based login using QR code with GetQRChannel
-func (s *WhatsAppService) connectWithEventLogin() error {
-	s.logger.Info("Starting QR code login flow...")
-	
-	qrCount := 0
-	
-	// Get QR channel
+// StartLogin connects an unpaired device and starts emitting login QR codes.
+// Does nothing if a login is already in progress.
+func (s *WhatsAppService) StartLogin() error {
+	s.login.mu.Lock()
+	defer s.login.mu.Unlock()
+
+	if s.client.Store.ID != nil {
+		return ErrAlreadyLoggedIn
+	}
+	if s.login.active {
+		return nil
+	}
+
+	// A previous login attempt may have left the websocket open
+	if s.client.IsConnected() {
+		s.client.Disconnect()
+	}
+
+	// Get QR channel (must be requested before connecting)
 	qrChan, err := s.client.GetQRChannel(context.Background())
 	if err != nil {
-		// If GetQRChannel not supported, use event-based fallback
-		s.logger.Warn("QR channel not supported, using event-based login")
-		return s.connectWithEventBasedLogin()
-	}
-	
-	// Add event handler for connection events
-	eventHandler := func(evt interface{}) {
-		switch v := evt.(type) {
-		case *events.PairSuccess:
-			s.logger.Info("Pairing successful!", "jid", v.ID.String())
-			fmt.Println("\n✅ Pairing successful! Finalizing connection...\n")
-			
-		case *events.Connected:
-			s.logger.Info("Connection established successfully")
-			fmt.Println("✅ Connected to WhatsApp successfully!\n")
-			
-		case *events.LoggedOut:
-			s.logger.Error("Device logged out", "reason", v.Reason)
-			fmt.Printf("\n❌ Device logged out: %s\n\n", v.Reason)
-		}
+		return fmt.Errorf("failed to start login: %w", err)
 	}
-	
-	s.client.AddEventHandler(eventHandler)
-	
-	// Connect to WhatsApp
+
 	err = s.client.Connect()
 	if err != nil {
 		return fmt.Errorf("failed to connect to WhatsApp: %w", err)
 	}
-	
-	s.logger.Info("Connected to WhatsApp, waiting for QR code...")
-	
-	// Process QR codes from channel
+
+	s.login.active = true
+	s.login.code = ""
+	s.login.expiresAt = time.Time{}
+	s.login.lastEvent = ""
+	s.login.codeReady = make(chan struct{})
+
+	go s.watchLogin(qrChan, s.login.codeReady)
+
+	return nil
+}
+
+// watchLogin keeps the latest QR code of a running login until the channel is closed
+func (s *WhatsAppService) watchLogin(qrChan <-chan whatsmeow.QRChannelItem, codeReady chan struct{}) {
+	refreshCount := 0
 	for evt := range qrChan {
-		if evt.Event == "code" {
-			qrCount++
-			
-			// Generate QR code as PNG file
-			qrFilename := "whatsapp-qrcode.png"
-			err := qrcode.WriteFile(evt.Code, qrcode.Medium, 512, qrFilename)
-			if err != nil {
-				s.logger.Error("Failed to generate QR code PNG", "error", err)
-				continue
+		s.login.mu.Lock()
+		s.login.lastEvent = evt.Event
+		if evt.Event == whatsmeow.QRChannelEventCode {
+			s.login.code = evt.Code
+			s.login.expiresAt = time.Now().Add(evt.Timeout)
+			if refreshCount == 0 {
+				close(codeReady)
 			}
-			
-			// Get absolute path
-			absPath, _ := os.Getwd()
-			fullPath := fmt.Sprintf("%s/%s", absPath, qrFilename)
-			
-			if qrCount == 1 {
-				s.logger.Info("QR Code generated successfully")
-				fmt.Println("\n╔══════════════════════════════════════════════════════════════════╗")
-				fmt.Println("║                   QR CODE GENERATED!                            ║")
-				fmt.Println("╚══════════════════════════════════════════════════════════════════╝")
-				fmt.Printf("\n📱 QR Code saved to: %s\n\n", fullPath)
-				fmt.Println("🔹 Steps to link:")
-				fmt.Println("   1. Open the QR code image file")
-				fmt.Println("   2. Open WhatsApp on your phone")
-				fmt.Println("   3. Go to: Settings > Linked Devices")
-				fmt.Println("   4. Tap 'Link a Device'")
-				fmt.Println("   5. Scan the QR code from the image file")
-				fmt.Println("\n⏳ Waiting for scan... (Press Ctrl+C to cancel)")
-				fmt.Println("   QR code will auto-refresh every ~20 seconds\n")
-			} else {
-				s.logger.Info("QR Code refreshed", "count", qrCount)
-				fmt.Printf("🔄 QR Code refreshed (#%d)\n", qrCount)
-			}
-			
-			s.logger.Info("QR code saved", "file", fullPath, "refresh_count", qrCount)
 		} else {
-			s.logger.Info("QR channel event", "event", evt.Event)
-			// Channel closed, check if we're connected
-			if s.client.IsLoggedIn() {
-				s.logger.Info("Successfully logged in!")
-				// Register main event handler
-				s.client.AddEventHandler(s.handleEvent)
-				return nil
-			}
-			// If not logged in and channel closed, return error
-			if evt.Event == "timeout" {
-				return fmt.Errorf("QR code scan timeout")
-			}
-			if evt.Event == "error" {
-				return fmt.Errorf("QR code error: %v", evt.Error)
-			}
+			s.login.code = ""
 		}
-	}
-	
-	s.logger.Info("Login completed successfully")
-	return nil
-}
+		s.login.mu.Unlock()
 
-// connectWithEventBasedLogin is fallback for older whatsmeow versions
-func (s *WhatsAppService) connectWithEventBasedLogin() error {
-	s.logger.Info("Using event-based QR code login (legacy mode)...")
-	
-	loginChan := make(chan error, 1)
-	qrCount := 0
-	
-	eventHandler := func(evt interface{}) {
-		switch v := evt.(type) {
-		case *events.QR:
-			qrCount++
-			qrCodeString := v.Codes[len(v.Codes)-1]
-			
-			qrFilename := "whatsapp-qrcode.png"
-			err := qrcode.WriteFile(qrCodeString, qrcode.Medium, 512, qrFilename)
-			if err != nil {
-				s.logger.Error("Failed to generate QR code PNG", "error", err)
-				return
-			}
-			
-			absPath, _ := os.Getwd()
-			fullPath := fmt.Sprintf("%s/%s", absPath, qrFilename)
-			
-			if qrCount == 1 {
-				s.logger.Info("QR Code generated successfully")
-				fmt.Println("\n╔══════════════════════════════════════════════════════════════════╗")
-				fmt.Println("║                   QR CODE GENERATED!                            ║")
-				fmt.Println("╚══════════════════════════════════════════════════════════════════╝")
-				fmt.Printf("\n📱 QR Code saved to: %s\n\n", fullPath)
-				fmt.Println("⏳ Waiting for scan...\n")
+		switch evt.Event {
+		case whatsmeow.QRChannelEventCode:
+			refreshCount++
+			if refreshCount == 1 {
+				s.log().Info("Login QR code ready", "endpoint", "/api/v1/session/qr")
+				fmt.Println("\n📱 WhatsApp device not linked yet. Link it remotely with:")
+				fmt.Println("   GET  /api/v1/session/qr          (QR code PNG, ?format=text for the raw string)")
+				fmt.Print("   POST /api/v1/session/pair-code   (pairing code for phone=628xxx)\n\n")
 			} else {
-				s.logger.Info("QR Code refreshed", "count", qrCount)
-				fmt.Printf("🔄 QR Code refreshed (#%d)\n", qrCount)
+				s.log().Debug("Login QR code refreshed", "refresh_count", refreshCount)
 			}
-			
-		case *events.PairSuccess:
-			s.logger.Info("Pairing successful!", "jid", v.ID.String())
-			fmt.Println("\n✅ Pairing successful!\n")
-			
-		case *events.Connected:
-			s.logger.Info("Connection established successfully")
-			fmt.Println("✅ Connected to WhatsApp successfully!\n")
-			s.client.AddEventHandler(s.handleEvent)
-			loginChan <- nil
-			
-		case *events.LoggedOut:
-			s.logger.Error("Device logged out", "reason", v.Reason)
-			loginChan <- fmt.Errorf("device logged out: %s", v.Reason)
+		case whatsmeow.QRChannelSuccess.Event:
+			s.log().Info("Successfully logged in!")
+		case whatsmeow.QRChannelEventError:
+			s.log().Error("Login failed", "event", evt.Event, "error", evt.Error)
+		default:
+			s.log().Warn("Login ended without pairing, request a new QR code to retry", "event", evt.Event)
 		}
 	}
-	
-	s.client.AddEventHandler(eventHandler)
-	
-	err := s.client.Connect()
+
+	s.login.mu.Lock()
+	s.login.active = false
+	s.login.mu.Unlock()
+}
+
+// LoginQR returns the current login QR code and when it expires. A new login is
+// started if none is running (e.g. the previous one timed out), waiting up to
+// loginCodeWait for the first code.
+func (s *WhatsAppService) LoginQR(ctx context.Context) (string, time.Time, error) {
+	if _, err := s.waitForLoginCode(ctx); err != nil {
+		return "", time.Time{}, err
+	}
+
+	s.login.mu.Lock()
+	defer s.login.mu.Unlock()
+
+	if s.login.code == "" {
+		return "", time.Time{}, fmt.Errorf("login ended (%s), request a new QR code", s.login.lastEvent)
+	}
+	return s.login.code, s.login.expiresAt, nil
+}
+
+// PairPhone links the device with a pairing code entered on the phone
+// (Linked Devices > Link with phone number) instead of scanning a QR code
+func (s *WhatsAppService) PairPhone(ctx context.Context, phone string) (string, error) {
+	normalized := normalizePhoneNumber(phone)
+	if normalized == "" {
+		return "", fmt.Errorf("invalid phone number format")
+	}
+
+	// Pairing codes can only be requested once the login websocket is ready
+	if _, err := s.waitForLoginCode(ctx); err != nil {
+		return "", err
+	}
+
+	code, err := s.client.PairPhone(ctx, normalized, true, whatsmeow.PairClientChrome, "Chrome (Linux)")
 	if err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+		return "", fmt.Errorf("failed to request pairing code: %w", err)
+	}
+
+	s.log().Info("Pairing code requested", "phone", normalized)
+	return code, nil
+}
+
+// waitForLoginCode starts a login if needed and waits until its first QR code is emitted.
+// Returns the channel closed when a code is available.
+func (s *WhatsAppService) waitForLoginCode(ctx context.Context) (chan struct{}, error) {
+	if err := s.StartLogin(); err != nil {
+		return nil, err
+	}
+
+	s.login.mu.Lock()
+	codeReady := s.login.codeReady
+	s.login.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, loginCodeWait)
+	defer cancel()
+
+	select {
+	case <-codeReady:
+		return codeReady, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("login QR code not received from WhatsApp in time, try again")
 	}
-	
-	return <-loginChan
 }
 
-// Disconnect disconnects from WhatsApp
+// Logout unlinks the device from the phone and deletes its session
+func (s *WhatsAppService) Logout(ctx context.Context) error {
+	if s.client.Store.ID == nil {
+		return ErrNotLoggedIn
+	}
+
+	if err := s.client.Logout(ctx); err != nil {
+		return fmt.Errorf("failed to logout: %w", err)
+	}
+
+	s.log().Warn("WhatsApp device logged out")
+	return nil
+}
+
+// Disconnect disconnects from WhatsApp and stops reconnecting
 func (s *WhatsAppService) Disconnect() {
+	s.stopReconnect()
 	s.client.Disconnect()
-	s.logger.Info("WhatsApp client disconnected")
+	if s.ID() != "" {
+		s.setConnectionState(ConnectionStateDisconnected, "disconnected manually")
+	}
+	s.log().Info("WhatsApp client disconnected")
 }
 
 // IsConnected checks if client is connected
@@ -280,6 +357,11 @@ func (s *WhatsAppService) IsConnected() bool {
 	return s.client.IsConnected()
 }
 
+// IsLoggedIn checks if client is connected and authenticated with WhatsApp
+func (s *WhatsAppService) IsLoggedIn() bool {
+	return s.client.IsLoggedIn()
+}
+
 // GetClient returns the WhatsApp client
 func (s *WhatsAppService) GetClient() *whatsmeow.Client {
 	return s.client
@@ -287,44 +369,73 @@ func (s *WhatsAppService) GetClient() *whatsmeow.Client {
 
 // ValidateDestination validates and parses destination (personal or group)
 func (s *WhatsAppService) ValidateDestination(destination string) (types.JID, string, error) {
-	// Check if it's a group JID
-	if strings.Contains(destination, "@g.us") {
-		jid, err := types.ParseJID(destination)
-		if err != nil {
-			return types.JID{}, "", fmt.Errorf("invalid group JID: %w", err)
-		}
+	jid, destType, err := parseDestination(destination)
+	if err != nil {
+		return types.JID{}, "", err
+	}
+	if !s.IsConnected() {
+		return types.JID{}, "", ErrNotConnected
+	}
 
+	if destType == "group" {
 		// Verify group exists and bot is member
 		_, err = s.client.GetGroupInfo(jid)
+		if errors.Is(err, whatsmeow.ErrGroupNotFound) || errors.Is(err, whatsmeow.ErrNotInGroup) {
+			return types.JID{}, "", fmt.Errorf("%w: %w", ErrGroupNotFound, err)
+		}
 		if err != nil {
-			return types.JID{}, "", fmt.Errorf("group not found or bot not a member: %w", err)
+			// Timeouts and disconnects may succeed on retry
+			return types.JID{}, "", fmt.Errorf("failed to get group info: %w", err)
 		}
 
-		return jid, "group", nil
-	}
-
-	// Handle personal chat
-	phone := s.normalizePhoneNumber(destination)
-	if phone == "" {
-		return types.JID{}, "", fmt.Errorf("invalid phone number format")
+		return jid, destType, nil
 	}
 
 	// Check if number is on WhatsApp
-	resp, err := s.client.IsOnWhatsApp([]string{phone})
+	resp, err := s.client.IsOnWhatsApp([]string{jid.User})
 	if err != nil {
 		return types.JID{}, "", fmt.Errorf("failed to check WhatsApp status: %w", err)
 	}
 
 	if len(resp) == 0 || !resp[0].IsIn {
-		return types.JID{}, "", fmt.Errorf("phone number not registered on WhatsApp")
+		return types.JID{}, "", ErrNotOnWhatsApp
+	}
+
+	return jid, destType, nil
+}
+
+// parseDestination parses a destination into a JID without contacting WhatsApp
+func parseDestination(destination string) (types.JID, string, error) {
+	// Check if it's a group JID
+	if strings.Contains(destination, "@g.us") {
+		jid, err := types.ParseJID(destination)
+		if err != nil {
+			return types.JID{}, "", fmt.Errorf("%w: invalid group JID: %w", ErrInvalidDestination, err)
+		}
+		return jid, "group", nil
+	}
+
+	// Handle personal chat
+	phone := normalizePhoneNumber(destination)
+	if phone == "" {
+		return types.JID{}, "", fmt.Errorf("%w: invalid phone number format", ErrInvalidDestination)
 	}
 
 	jid := types.NewJID(phone, types.DefaultUserServer)
 	return jid, "personal", nil
 }
 
+// DestinationType returns the type of a destination ("personal" or "group"), "invalid" if it can't be parsed
+func DestinationType(destination string) string {
+	_, destType, err := parseDestination(destination)
+	if err != nil {
+		return "invalid"
+	}
+	return destType
+}
+
 // normalizePhoneNumber normalizes phone number to format 628xxx
-func (s *WhatsAppService) normalizePhoneNumber(phone string) string {
+func normalizePhoneNumber(phone string) string {
 	// Remove all non-digit characters
 	re := regexp.MustCompile(`[^\d]`)
 	phone = re.ReplaceAllString(phone, "")
@@ -345,33 +456,136 @@ func (s *WhatsAppService) normalizePhoneNumber(phone string) string {
 	return phone
 }
 
-// SendMessage sends a text message to WhatsApp
-func (s *WhatsAppService) SendMessage(ctx context.Context, to types.JID, text string) (string, error) {
+// SendMessage sends the text message of a transaction to WhatsApp
+func (s *WhatsAppService) SendMessage(ctx context.Context, to types.JID, text, trxID string) (string, error) {
 	if !s.IsConnected() {
-		return "", fmt.Errorf("WhatsApp client not connected")
+		return "", ErrNotConnected
 	}
 
 	message := &waProto.Message{
 		Conversation: &text,
 	}
 
+	start := time.Now()
+	resp, err := s.client.SendMessage(ctx, to, message)
+	metrics.ObserveSend("text", time.Since(start), err)
+	if err != nil {
+		return "", fmt.Errorf("failed to send message: %w", err)
+	}
+
+	s.saveOutgoing(trxID, to, resp, "text", text)
+	return resp.ID, nil
+}
+
+// SendMedia uploads the image or document of a transaction and sends it with a caption to WhatsApp
+func (s *WhatsAppService) SendMedia(ctx context.Context, to types.JID, media *model.TransactionMedia, caption, trxID string) (string, error) {
+	if !s.IsConnected() {
+		return "", ErrNotConnected
+	}
+
+	var message *waProto.Message
+	switch media.Type {
+	case model.MediaTypeImage:
+		uploaded, err := s.client.Upload(ctx, media.Data, whatsmeow.MediaImage)
+		if err != nil {
+			return "", fmt.Errorf("failed to send media: upload failed: %w", err)
+		}
+		message = &waProto.Message{
+			ImageMessage: &waProto.ImageMessage{
+				Caption:       proto.String(caption),
+				Mimetype:      proto.String(media.MimeType),
+				URL:           proto.String(uploaded.URL),
+				DirectPath:    proto.String(uploaded.DirectPath),
+				MediaKey:      uploaded.MediaKey,
+				FileEncSHA256: uploaded.FileEncSHA256,
+				FileSHA256:    uploaded.FileSHA256,
+				FileLength:    proto.Uint64(uploaded.FileLength),
+			},
+		}
+	case model.MediaTypeDocument:
+		uploaded, err := s.client.Upload(ctx, media.Data, whatsmeow.MediaDocument)
+		if err != nil {
+			return "", fmt.Errorf("failed to send media: upload failed: %w", err)
+		}
+		message = &waProto.Message{
+			DocumentMessage: &waProto.DocumentMessage{
+				Caption:       proto.String(caption),
+				Title:         proto.String(media.FileName),
+				FileName:      proto.String(media.FileName),
+				Mimetype:      proto.String(media.MimeType),
+				URL:           proto.String(uploaded.URL),
+				DirectPath:    proto.String(uploaded.DirectPath),
+				MediaKey:      uploaded.MediaKey,
+				FileEncSHA256: uploaded.FileEncSHA256,
+				FileSHA256:    uploaded.FileSHA256,
+				FileLength:    proto.Uint64(uploaded.FileLength),
+			},
+		}
+	default:
+		return "", fmt.Errorf("unsupported media type: %s", media.Type)
+	}
+
+	start := time.Now()
 	resp, err := s.client.SendMessage(ctx, to, message)
+	metrics.ObserveSend(media.Type, time.Since(start), err)
 	if err != nil {
 		return "", fmt.Errorf("failed to send message: %w", err)
 	}
 
+	s.saveOutgoing(trxID, to, resp, media.Type, caption)
 	return resp.ID, nil
 }
 
+// saveOutgoing adds a sent transaction message to the message log
+func (s *WhatsAppService) saveOutgoing(trxID string, to types.JID, resp whatsmeow.SendResponse, messageType, content string) {
+	s.saveMessage(&repository.MessageRecord{
+		Direction:     repository.MessageDirectionOutgoing,
+		MessageID:     resp.ID,
+		ChatJID:       to.String(),
+		Sender:        s.ID(),
+		Device:        s.ID(),
+		Type:          messageType,
+		Content:       content,
+		TrxID:         trxID,
+		WebhookStatus: repository.MessageWebhookNone,
+		Timestamp:     resp.Timestamp,
+	})
+}
+
+// saveMessage adds a message to the message log of its transaction
+func (s *WhatsAppService) saveMessage(record *repository.MessageRecord) {
+	if s.messages == nil {
+		return
+	}
+	if err := s.messages.Save(record); err != nil {
+		s.log().WithTrxID(record.TrxID).Error("Failed to save message to message log",
+			"error", err,
+			"message_id", record.MessageID,
+			"direction", record.Direction,
+		)
+	}
+}
+
 // handleEvent handles WhatsApp events
 func (s *WhatsAppService) handleEvent(evt interface{}) {
 	switch v := evt.(type) {
 	case *events.Message:
 		s.handleIncomingMessage(v)
+	case *events.Receipt:
+		s.handleReceipt(v)
+	case *events.PairSuccess:
+		s.logger.Store(s.baseLogger.WithDevice(v.ID.User))
+		s.log().Info("Pairing successful!", "jid", v.ID.String())
+		fmt.Print("\n✅ Pairing successful! Finalizing connection...\n\n")
 	case *events.Connected:
-		s.logger.Info("WhatsApp client connected")
-	case *events.Disconnected:
-		s.logger.Warn("WhatsApp client disconnected")
+		s.log().Info("WhatsApp client connected")
+		s.handleConnectionEvent(v)
+		connectedHandlers, _ := s.hooks()
+		for _, handler := range connectedHandlers {
+			go handler()
+		}
+	default:
+		s.handleConnectionEvent(evt)
 	}
 }
 
@@ -391,37 +605,64 @@ func (s *WhatsAppService) handleIncomingMessage(evt *events.Message) {
 	chatJID := evt.Info.Chat.String()
 	if len(s.webhookWhitelist) > 0 {
 		if !s.isWhitelisted(chatJID) {
-			s.logger.Info("Message from non-whitelisted JID ignored",
+			s.log().Info("Message from non-whitelisted JID ignored",
 				"jid", chatJID,
 			)
+			metrics.ObserveIncoming(metrics.IncomingNotWhitelisted)
 			return
 		}
 	}
 
-	// Get tracking info for this chat from database
-	trackingRecord, err := s.repo.GetByDestination(chatJID)
+	// Correlate the message to a tracked transaction
+	contextInfo := getContextInfo(evt.Message)
+	trackingRecord, matchStrategy, err := s.findTransaction(chatJID, contextInfo)
 	if err != nil {
-		s.logger.Error("Failed to get tracking info", "error", err, "jid", chatJID)
+		s.log().Error("Failed to get tracking info", "error", err, "jid", chatJID)
+		metrics.ObserveIncoming(metrics.IncomingError)
 		return
 	}
 	if trackingRecord == nil {
 		// Not related to any tracked transaction
+		metrics.ObserveIncoming(metrics.IncomingUnmatched)
 		return
 	}
+	metrics.ObserveIncoming(metrics.IncomingMatched)
+	if err := s.repo.MarkReplied(trackingRecord.TrxID, evt.Info.Timestamp); err != nil {
+		s.log().WithTrxID(trackingRecord.TrxID).Error("Failed to record reply", "error", err)
+	}
 
 	// Extract message content
 	messageContent := ""
 	messageType := "text"
 
-	if evt.Message.Conversation != nil {
+	media := getMediaInfo(evt.Message)
+	if media != nil {
+		messageType = media.Type
+		messageContent = media.Caption
+	} else if evt.Message.Conversation != nil {
 		messageContent = *evt.Message.Conversation
 	} else if evt.Message.ExtendedTextMessage != nil {
-		messageContent = *evt.Message.ExtendedTextMessage.Text
+		messageContent = evt.Message.ExtendedTextMessage.GetText()
+	}
+
+	// Entry of the message log of the transaction, saved once the webhook is queued
+	message := &repository.MessageRecord{
+		Direction: repository.MessageDirectionIncoming,
+		MessageID: evt.Info.ID,
+		ChatJID:   chatJID,
+		Sender:    evt.Info.Sender.User,
+		Device:    s.ID(),
+		Type:      messageType,
+		Content:   messageContent,
+		QuotedID:  contextInfo.GetStanzaID(),
+		TrxID:     trackingRecord.TrxID,
+		Timestamp: evt.Info.Timestamp,
 	}
 
 	// Build webhook payload
 	payload := &model.WebhookPayload{
-		Event: "message_received",
+		Event:  "message_received",
+		Device: s.ID(),
 		Sender: model.Sender{
 			Phone: evt.Info.Sender.User,
 			Name:  evt.Info.PushName,
@@ -434,25 +675,19 @@ func (s *WhatsAppService) handleIncomingMessage(evt *events.Message) {
 		Context: model.MessageContext{
 			ChatType:          trackingRecord.DestinationType,
 			IsReply:           false,
+			TrxID:             trackingRecord.TrxID,
+			MatchStrategy:     matchStrategy,
 			OriginalMessageID: trackingRecord.MessageID,
 		},
 	}
 
 	// Extract quoted message content if this is a reply
-	if evt.Message.ExtendedTextMessage != nil && 
-	   evt.Message.ExtendedTextMessage.ContextInfo != nil {
-		
+	if contextInfo.GetStanzaID() != "" {
 		payload.Context.IsReply = true
-		
-		// Get quoted message ID (use StanzaID field)
-		if evt.Message.ExtendedTextMessage.ContextInfo.StanzaID != nil {
-			payload.Context.OriginalMessageID = *evt.Message.ExtendedTextMessage.ContextInfo.StanzaID
-		}
-		
+		payload.Context.OriginalMessageID = contextInfo.GetStanzaID()
+
 		// Get quoted message content
-		if evt.Message.ExtendedTextMessage.ContextInfo.QuotedMessage != nil {
-			quotedMsg := evt.Message.ExtendedTextMessage.ContextInfo.QuotedMessage
-			
+		if quotedMsg := contextInfo.GetQuotedMessage(); quotedMsg != nil {
 			if quotedMsg.Conversation != nil {
 				payload.Context.QuotedMessageContent = *quotedMsg.Conversation
 			} else if quotedMsg.ExtendedTextMessage != nil && quotedMsg.ExtendedTextMessage.Text != nil {
@@ -461,24 +696,249 @@ func (s *WhatsAppService) handleIncomingMessage(evt *events.Message) {
 		}
 	}
 
-	// Send to Otomax webhook
-	if s.otomaxService != nil {
-		ctx := context.Background()
-		err := s.otomaxService.SendWebhook(ctx, payload, trackingRecord.TrxID)
+	if media != nil {
+		payload.Message.Caption = media.Caption
+		payload.Message.MimeType = media.MimeType
+		payload.Message.FileName = media.FileName
+		payload.Message.FileSize = media.FileSize
+
+		// Downloading can take a while; don't block the event handler
+		go func() {
+			s.attachMedia(evt, media, payload, trackingRecord.TrxID)
+			s.queueWebhook(payload, message, matchStrategy)
+		}()
+		return
+	}
+
+	s.queueWebhook(payload, message, matchStrategy)
+}
+
+// queueWebhook queues a received message for delivery to the Otomax webhook and
+// adds it to the message log with the outbox delivery
+func (s *WhatsAppService) queueWebhook(payload *model.WebhookPayload, message *repository.MessageRecord, matchStrategy string) {
+	trxID, from := message.TrxID, message.Sender
+	message.MediaURL = payload.Message.MediaURL
+
+	if s.otomaxService == nil {
+		message.WebhookStatus = repository.MessageWebhookNone
+		s.saveMessage(message)
+		return
+	}
+
+	ctx := context.Background()
+	deliveryID, err := s.otomaxService.SendWebhook(ctx, payload, trxID)
+	if err != nil {
+		s.log().WithTrxID(trxID).Error("Failed to queue webhook",
+			"error", err,
+			"from", from,
+		)
+		message.WebhookStatus = repository.MessageWebhookFailed
+		s.saveMessage(message)
+		return
+	}
+	message.WebhookStatus = repository.WebhookStatusPending
+	message.WebhookDeliveryID = deliveryID
+	s.saveMessage(message)
+
+	// Log webhook queued for delivery
+	s.log().WithTrxID(trxID).Info("Message received and queued for webhook",
+		"from", from,
+		"type", payload.Message.Type,
+		"message", payload.Message.Content,
+		"match_strategy", matchStrategy,
+	)
+}
+
+// attachMedia downloads the media of a received message and sets its download URL in the payload.
+// The payload is still forwarded without URL if the media can't be stored.
+func (s *WhatsAppService) attachMedia(evt *events.Message, media *mediaInfo, payload *model.WebhookPayload, trxID string) {
+	log := s.log().WithTrxID(trxID)
+
+	if s.mediaService == nil {
+		return
+	}
+	if media.FileSize > s.mediaService.MaxSize() {
+		log.Warn("Received media too large, forwarding without download",
+			"message_id", evt.Info.ID,
+			"file_size", media.FileSize,
+		)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mediaDownloadTimeout)
+	defer cancel()
+
+	data, err := s.client.Download(ctx, media.Downloadable)
+	if err != nil {
+		log.Error("Failed to download media", "error", err, "message_id", evt.Info.ID)
+		return
+	}
+
+	record, err := s.mediaService.Store(&repository.MediaRecord{
+		MessageID: evt.Info.ID,
+		ChatJID:   evt.Info.Chat.String(),
+		TrxID:     trxID,
+		MediaType: media.Type,
+		MimeType:  media.MimeType,
+		FileName:  media.FileName,
+	}, data)
+	if err != nil {
+		log.Error("Failed to store media", "error", err, "message_id", evt.Info.ID)
+		return
+	}
+
+	payload.Message.MediaURL = s.mediaService.URL(record.ID)
+	payload.Message.FileSize = record.FileSize
+}
+
+// handleReceipt records delivery and read receipts of tracked transaction messages
+func (s *WhatsAppService) handleReceipt(evt *events.Receipt) {
+	// Receipts from our own other devices don't say anything about the recipient
+	if evt.IsFromMe || s.repo == nil {
+		return
+	}
+
+	var status string
+	switch evt.Type {
+	case types.ReceiptTypeDelivered:
+		status = model.MessageStatusDelivered
+	case types.ReceiptTypeRead, types.ReceiptTypePlayed:
+		status = model.MessageStatusRead
+	default:
+		return
+	}
+
+	for _, messageID := range evt.MessageIDs {
+		var record *repository.TransactionRecord
+		var err error
+		if status == model.MessageStatusRead {
+			record, err = s.repo.MarkRead(messageID, evt.Timestamp)
+		} else {
+			record, err = s.repo.MarkDelivered(messageID, evt.Timestamp)
+		}
 		if err != nil {
-			s.logger.WithTrxID(trackingRecord.TrxID).Error("Failed to send webhook",
+			s.log().Error("Failed to record message receipt",
 				"error", err,
-				"from", evt.Info.Sender.User,
+				"message_id", messageID,
+				"status", status,
 			)
-			return
+			continue
 		}
-		
-		// Log successful webhook delivery
-		s.logger.WithTrxID(trackingRecord.TrxID).Info("Message received and forwarded to webhook",
-			"from", evt.Info.Sender.User,
-			"message", messageContent,
+		if record == nil {
+			// Not a tracked message, or receipt already recorded (e.g. another group participant)
+			continue
+		}
+
+		s.log().WithTrxID(record.TrxID).Info("Message receipt received",
+			"message_id", messageID,
+			"status", status,
+			"recipient", evt.Sender.User,
+		)
+
+		if s.otomaxService == nil {
+			continue
+		}
+		payload := &model.MessageStatusPayload{
+			Event:       "message_status",
+			TrxID:       record.TrxID,
+			MessageID:   messageID,
+			Status:      status,
+			Destination: record.Destination,
+			Device:      s.ID(),
+			Recipient:   evt.Sender.User,
+			SentAt:      record.SentAt,
+			Timestamp:   evt.Timestamp,
+		}
+		if err := s.otomaxService.SendMessageStatus(context.Background(), payload); err != nil {
+			s.log().WithTrxID(record.TrxID).Error("Failed to queue message status webhook",
+				"error", err,
+				"status", status,
+			)
+		}
+	}
+}
+
+// findTransaction finds the transaction sent by this device that an incoming message belongs to.
+// Replies are matched by the quoted message ID; the latest transaction in the chat is used
+// for messages that don't quote anything or quote a message that is not a transaction.
+func (s *WhatsAppService) findTransaction(chatJID string, contextInfo *waProto.ContextInfo) (*repository.TransactionRecord, string, error) {
+	strategy := model.MatchStrategyLatestInChat
+	if quotedID := contextInfo.GetStanzaID(); quotedID != "" {
+		record, err := s.repo.GetByMessageID(s.ID(), chatJID, quotedID)
+		if err != nil {
+			return nil, "", err
+		}
+		if record != nil {
+			return record, model.MatchStrategyQuotedMessage, nil
+		}
+		s.log().Debug("Reply to untracked message, using latest transaction in chat",
+			"jid", chatJID,
+			"quoted_message_id", quotedID,
 		)
+		strategy = model.MatchStrategyLatestInChatUntrackedQuote
 	}
+
+	record, err := s.repo.GetByDestination(s.ID(), chatJID)
+	if err != nil {
+		return nil, "", err
+	}
+	return record, strategy, nil
+}
+
+// mediaDownloadTimeout bounds the download of a single received media file
+const mediaDownloadTimeout = 2 * time.Minute
+
+// mediaInfo describes the media attachment of a received message
+type mediaInfo struct {
+	Type         string
+	Caption      string
+	MimeType     string
+	FileName     string
+	FileSize     int64
+	Downloadable whatsmeow.DownloadableMessage
+}
+
+// getMediaInfo returns the image, video, audio or document attachment of a message, if any
+func getMediaInfo(msg *waProto.Message) *mediaInfo {
+	switch {
+	case msg.GetImageMessage() != nil:
+		m := msg.GetImageMessage()
+		return &mediaInfo{Type: "image", Caption: m.GetCaption(), MimeType: m.GetMimetype(), FileSize: int64(m.GetFileLength()), Downloadable: m}
+	case msg.GetVideoMessage() != nil:
+		m := msg.GetVideoMessage()
+		return &mediaInfo{Type: "video", Caption: m.GetCaption(), MimeType: m.GetMimetype(), FileSize: int64(m.GetFileLength()), Downloadable: m}
+	case msg.GetAudioMessage() != nil:
+		m := msg.GetAudioMessage()
+		return &mediaInfo{Type: "audio", MimeType: m.GetMimetype(), FileSize: int64(m.GetFileLength()), Downloadable: m}
+	case msg.GetDocumentMessage() != nil:
+		m := msg.GetDocumentMessage()
+		return &mediaInfo{Type: "document", Caption: m.GetCaption(), MimeType: m.GetMimetype(), FileName: m.GetFileName(), FileSize: int64(m.GetFileLength()), Downloadable: m}
+	case msg.GetDocumentWithCaptionMessage().GetMessage().GetDocumentMessage() != nil:
+		m := msg.GetDocumentWithCaptionMessage().GetMessage().GetDocumentMessage()
+		return &mediaInfo{Type: "document", Caption: m.GetCaption(), MimeType: m.GetMimetype(), FileName: m.GetFileName(), FileSize: int64(m.GetFileLength()), Downloadable: m}
+	}
+	return nil
+}
+
+// getContextInfo returns the context info (quoted message, mentions) of a message, if any
+func getContextInfo(msg *waProto.Message) *waProto.ContextInfo {
+	switch {
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetContextInfo()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetContextInfo()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetContextInfo()
+	case msg.GetAudioMessage() != nil:
+		return msg.GetAudioMessage().GetContextInfo()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetContextInfo()
+	case msg.GetDocumentWithCaptionMessage().GetMessage().GetDocumentMessage() != nil:
+		return msg.GetDocumentWithCaptionMessage().GetMessage().GetDocumentMessage().GetContextInfo()
+	case msg.GetStickerMessage() != nil:
+		return msg.GetStickerMessage().GetContextInfo()
+	}
+	return nil
 }
 
 // isWhitelisted checks if JID is in whitelist
@@ -494,12 +954,19 @@ func (s *WhatsAppService) isWhitelisted(jid string) bool {
 // GetConnectionStatus returns connection status information
 func (s *WhatsAppService) GetConnectionStatus() map[string]interface{} {
 	status := map[string]interface{}{
-		"connected": s.IsConnected(),
+		"connected":  s.IsConnected(),
+		"logged_in":  s.client.IsLoggedIn(),
+		"connection": s.ConnectionInfo(),
 	}
 
 	if s.client.Store.ID != nil {
 		status["phone"] = s.client.Store.ID.User
 		status["device"] = "whatsapp-h2h-otomax"
+	} else {
+		// Unpaired device waiting for QR code or pairing code login
+		s.login.mu.Lock()
+		status["pairing"] = s.login.active
+		s.login.mu.Unlock()
 	}
 
 	return status
@@ -508,7 +975,7 @@ func (s *WhatsAppService) GetConnectionStatus() map[string]interface{} {
 // GetJoinedGroups retrieves all groups that the bot is a member of
 func (s *WhatsAppService) GetJoinedGroups(ctx context.Context) ([]*types.GroupInfo, error) {
 	if !s.IsConnected() {
-		return nil, fmt.Errorf("WhatsApp client not connected")
+		return nil, ErrNotConnected
 	}
 
 	groups, err := s.client.GetJoinedGroups(ctx)
@@ -523,7 +990,7 @@ func (s *WhatsAppService) GetJoinedGroups(ctx context.Context) ([]*types.GroupIn
 func (s *WhatsAppService) PrintJoinedGroups(ctx context.Context) {
 	groups, err := s.GetJoinedGroups(ctx)
 	if err != nil {
-		s.logger.Error("Failed to get joined groups", "error", err)
+		s.log().Error("Failed to get joined groups", "error", err)
 		return
 	}
 
@@ -557,8 +1024,8 @@ func (s *WhatsAppService) PrintJoinedGroups(ctx context.Context) {
 
 	fmt.Println("╔══════════════════════════════════════════════════════════════════════════╗")
 	fmt.Println("║  Copy the JID above to use as 'destination' parameter in API requests   ║")
-	fmt.Println("╚══════════════════════════════════════════════════════════════════════════╝\n")
+	fmt.Print("╚══════════════════════════════════════════════════════════════════════════╝\n\n")
 
-	s.logger.Info("Group list displayed", "total_groups", len(groups))
+	s.log().Info("Group list displayed", "total_groups", len(groups))
 }
 
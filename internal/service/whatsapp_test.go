@@ -0,0 +1,40 @@
+package service
+
+import (
+	"testing"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGetContextInfo(t *testing.T) {
+	quote := func() *waProto.ContextInfo {
+		return &waProto.ContextInfo{StanzaID: proto.String("3EB0A")}
+	}
+
+	tests := []struct {
+		name string
+		msg  *waProto.Message
+		want string // Quoted message ID, empty if none
+	}{
+		{"plain text", &waProto.Message{Conversation: proto.String("ok")}, ""},
+		{"extended text", &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{ContextInfo: quote()}}, "3EB0A"},
+		{"image", &waProto.Message{ImageMessage: &waProto.ImageMessage{ContextInfo: quote()}}, "3EB0A"},
+		{"video", &waProto.Message{VideoMessage: &waProto.VideoMessage{ContextInfo: quote()}}, "3EB0A"},
+		{"audio", &waProto.Message{AudioMessage: &waProto.AudioMessage{ContextInfo: quote()}}, "3EB0A"},
+		{"document", &waProto.Message{DocumentMessage: &waProto.DocumentMessage{ContextInfo: quote()}}, "3EB0A"},
+		{"document with caption", &waProto.Message{DocumentWithCaptionMessage: &waProto.FutureProofMessage{
+			Message: &waProto.Message{DocumentMessage: &waProto.DocumentMessage{Caption: proto.String("struk"), ContextInfo: quote()}},
+		}}, "3EB0A"},
+		{"sticker", &waProto.Message{StickerMessage: &waProto.StickerMessage{ContextInfo: quote()}}, "3EB0A"},
+		{"image without quote", &waProto.Message{ImageMessage: &waProto.ImageMessage{}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getContextInfo(tt.msg).GetStanzaID(); got != tt.want {
+				t.Errorf("getContextInfo() quoted ID = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
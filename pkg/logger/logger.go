@@ -52,6 +52,20 @@ func (l *Logger) WithDestination(destination string) *Logger {
 	}
 }
 
+// WithDevice returns a logger with WhatsApp device (sender number) context
+func (l *Logger) WithDevice(device string) *Logger {
+	return &Logger{
+		Logger: l.With("device", device),
+	}
+}
+
+// WithAPIKey returns a logger with the name of the API key that made the request
+func (l *Logger) WithAPIKey(name string) *Logger {
+	return &Logger{
+		Logger: l.With("api_key", name),
+	}
+}
+
 // WithError returns a logger with error context
 func (l *Logger) WithError(err error) *Logger {
 	return &Logger{
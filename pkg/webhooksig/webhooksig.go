@@ -0,0 +1,189 @@
+// Package webhooksig signs and verifies the webhooks sent by whatsapp-h2h-otomax.
+//
+// Every webhook carries three headers:
+//
+//	X-Timestamp:   Unix time (seconds) the request was signed
+//	X-Delivery-ID: Unique ID of the delivery, the same on every retry of the delivery
+//	X-Signature:   "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + deliveryID + "." + body))
+//
+// Receivers verify the signature with the shared secret, reject timestamps outside
+// a tolerance window and remember the delivery IDs they have seen to block replays
+// and to skip retries of a delivery they already processed:
+//
+//	verifier := webhooksig.NewVerifier(secret, 5*time.Minute)
+//	body, err := verifier.VerifyRequest(r)
+//	if errors.Is(err, webhooksig.ErrReplayed) {
+//		// Already processed, acknowledge without processing again
+//	}
+//	if processErr := process(body); processErr != nil {
+//		// Accept the next retry of the delivery
+//		verifier.Forget(r.Header.Get(webhooksig.HeaderDeliveryID))
+//	}
+package webhooksig
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header names of a signed webhook
+const (
+	HeaderSignature  = "X-Signature"
+	HeaderTimestamp  = "X-Timestamp"
+	HeaderDeliveryID = "X-Delivery-ID"
+)
+
+// signaturePrefix names the algorithm of the signature
+const signaturePrefix = "sha256="
+
+// DefaultTolerance is the maximum age (and clock skew) of a webhook accepted by a Verifier
+const DefaultTolerance = 5 * time.Minute
+
+// Verification errors
+var (
+	ErrMissingHeader    = errors.New("missing signature header")
+	ErrInvalidTimestamp = errors.New("invalid timestamp")
+	ErrExpired          = errors.New("timestamp outside tolerance")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrReplayed         = errors.New("delivery already received")
+)
+
+// Sign returns the X-Signature value of a delivery body signed at the given timestamp
+func Sign(secret []byte, timestamp, deliveryID string, body []byte) string {
+	return signaturePrefix + hex.EncodeToString(mac(secret, timestamp, deliveryID, body))
+}
+
+// SetHeaders signs a request body and sets the webhook headers on the request
+func SetHeaders(header http.Header, secret []byte, deliveryID string, body []byte, now time.Time) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	header.Set(HeaderTimestamp, timestamp)
+	header.Set(HeaderDeliveryID, deliveryID)
+	header.Set(HeaderSignature, Sign(secret, timestamp, deliveryID, body))
+}
+
+// Verify checks the signature and the age of a webhook body, without replay protection
+func Verify(secret []byte, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	timestamp := header.Get(HeaderTimestamp)
+	deliveryID := header.Get(HeaderDeliveryID)
+	signature := header.Get(HeaderSignature)
+	if timestamp == "" || deliveryID == "" || signature == "" {
+		return ErrMissingHeader
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: signed %s ago", ErrExpired, age.Round(time.Second))
+	}
+
+	hexSignature, ok := strings.CutPrefix(signature, signaturePrefix)
+	got, err := hex.DecodeString(hexSignature)
+	if !ok || err != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal(got, mac(secret, timestamp, deliveryID, body)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Verifier verifies webhooks and rejects deliveries seen within the tolerance window
+type Verifier struct {
+	secret    []byte
+	tolerance time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time // Delivery ID -> forget after
+}
+
+// NewVerifier creates a verifier for the shared secret, tolerance <= 0 uses DefaultTolerance
+func NewVerifier(secret string, tolerance time.Duration) *Verifier {
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	return &Verifier{
+		secret:    []byte(secret),
+		tolerance: tolerance,
+		seen:      make(map[string]time.Time),
+	}
+}
+
+// Verify checks a webhook and records its delivery ID. A delivery ID seen before
+// (a replay, or a retry of a delivery already received) is rejected with ErrReplayed.
+// Delivery IDs are remembered for twice the tolerance; receivers that need to skip
+// later retries too should store the delivery IDs they processed.
+func (v *Verifier) Verify(header http.Header, body []byte) error {
+	return v.verify(header, body, time.Now())
+}
+
+// verify is Verify at the given time
+func (v *Verifier) verify(header http.Header, body []byte, now time.Time) error {
+	if err := Verify(v.secret, header, body, v.tolerance, now); err != nil {
+		return err
+	}
+
+	// The delivery ID is signed, so a replay can't change it
+	key := header.Get(HeaderDeliveryID)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for seenKey, forgetAt := range v.seen {
+		if now.After(forgetAt) {
+			delete(v.seen, seenKey)
+		}
+	}
+	if _, ok := v.seen[key]; ok {
+		return ErrReplayed
+	}
+	// Older requests are rejected by the timestamp check from then on
+	v.seen[key] = now.Add(2 * v.tolerance)
+	return nil
+}
+
+// Forget removes a delivery ID, so the next retry of the delivery is accepted.
+// Call it when processing a verified delivery failed.
+func (v *Verifier) Forget(deliveryID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.seen, deliveryID)
+}
+
+// VerifyRequest reads and verifies the body of a webhook request. The body is
+// returned and also left readable on the request for the next handler.
+func (v *Verifier) VerifyRequest(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := v.Verify(r.Header, body); err != nil {
+		return body, err
+	}
+	return body, nil
+}
+
+// mac computes the HMAC-SHA256 of timestamp + "." + deliveryID + "." + body
+func mac(secret []byte, timestamp, deliveryID string, body []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(timestamp))
+	h.Write([]byte{'.'})
+	h.Write([]byte(deliveryID))
+	h.Write([]byte{'.'})
+	h.Write(body)
+	return h.Sum(nil)
+}
@@ -0,0 +1,227 @@
+package webhooksig
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var (
+	testSecret = []byte("s3cret")
+	testBody   = []byte(`{"event":"message_received","trxid":"TRX1"}`)
+	testNow    = time.Unix(1760000000, 0)
+)
+
+// signedHeader returns the headers of a delivery signed at signedAt
+func signedHeader(deliveryID string, signedAt time.Time) http.Header {
+	header := http.Header{}
+	SetHeaders(header, testSecret, deliveryID, testBody, signedAt)
+	return header
+}
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name       string
+		timestamp  string
+		deliveryID string
+		body       []byte
+	}{
+		{"other timestamp", "1760000001", "d1", testBody},
+		{"other delivery ID", "1760000000", "d2", testBody},
+		{"other body", "1760000000", "d1", []byte(`{}`)},
+	}
+
+	base := Sign(testSecret, "1760000000", "d1", testBody)
+	if base != Sign(testSecret, "1760000000", "d1", testBody) {
+		t.Fatal("Sign is not deterministic")
+	}
+	if len(base) != len(signaturePrefix)+64 || base[:len(signaturePrefix)] != signaturePrefix {
+		t.Fatalf("unexpected signature format %q", base)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(testSecret, tt.timestamp, tt.deliveryID, tt.body); got == base {
+				t.Errorf("signature doesn't cover the %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  func() http.Header
+		body    []byte
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			header: func() http.Header { return signedHeader("d1", testNow) },
+			body:   testBody,
+		},
+		{
+			name:   "clock skew within tolerance",
+			header: func() http.Header { return signedHeader("d1", testNow.Add(4*time.Minute)) },
+			body:   testBody,
+		},
+		{
+			name:    "expired",
+			header:  func() http.Header { return signedHeader("d1", testNow.Add(-6*time.Minute)) },
+			body:    testBody,
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "from the future",
+			header:  func() http.Header { return signedHeader("d1", testNow.Add(6*time.Minute)) },
+			body:    testBody,
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "tampered body",
+			header:  func() http.Header { return signedHeader("d1", testNow) },
+			body:    []byte(`{"event":"message_received","trxid":"TRX2"}`),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "delivery ID changed",
+			header: func() http.Header {
+				header := signedHeader("d1", testNow)
+				header.Set(HeaderDeliveryID, "d2")
+				return header
+			},
+			body:    testBody,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "wrong secret",
+			header: func() http.Header {
+				header := http.Header{}
+				SetHeaders(header, []byte("other"), "d1", testBody, testNow)
+				return header
+			},
+			body:    testBody,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "missing prefix",
+			header: func() http.Header {
+				header := signedHeader("d1", testNow)
+				header.Set(HeaderSignature, header.Get(HeaderSignature)[len(signaturePrefix):])
+				return header
+			},
+			body:    testBody,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "invalid timestamp",
+			header: func() http.Header {
+				header := signedHeader("d1", testNow)
+				header.Set(HeaderTimestamp, "yesterday")
+				return header
+			},
+			body:    testBody,
+			wantErr: ErrInvalidTimestamp,
+		},
+		{
+			name: "missing delivery ID",
+			header: func() http.Header {
+				header := signedHeader("d1", testNow)
+				header.Del(HeaderDeliveryID)
+				return header
+			},
+			body:    testBody,
+			wantErr: ErrMissingHeader,
+		},
+		{
+			name:    "unsigned",
+			header:  func() http.Header { return http.Header{} },
+			body:    testBody,
+			wantErr: ErrMissingHeader,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(testSecret, tt.header(), tt.body, DefaultTolerance, testNow)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifierReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		first   http.Header
+		second  http.Header
+		forget  bool
+		later   time.Duration
+		wantErr error
+	}{
+		{
+			name:    "same request replayed",
+			first:   signedHeader("d1", testNow),
+			second:  signedHeader("d1", testNow),
+			wantErr: ErrReplayed,
+		},
+		{
+			name:    "retry re-signed with a new timestamp",
+			first:   signedHeader("d1", testNow),
+			second:  signedHeader("d1", testNow.Add(30*time.Second)),
+			later:   30 * time.Second,
+			wantErr: ErrReplayed,
+		},
+		{
+			name:   "retry after Forget",
+			first:  signedHeader("d1", testNow),
+			second: signedHeader("d1", testNow.Add(30*time.Second)),
+			forget: true,
+			later:  30 * time.Second,
+		},
+		{
+			name:   "other delivery",
+			first:  signedHeader("d1", testNow),
+			second: signedHeader("d2", testNow),
+		},
+		{
+			name:    "replay after the tolerance window",
+			first:   signedHeader("d1", testNow),
+			second:  signedHeader("d1", testNow),
+			later:   11 * time.Minute,
+			wantErr: ErrExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier := NewVerifier(string(testSecret), 5*time.Minute)
+			if err := verifier.verify(tt.first, testBody, testNow); err != nil {
+				t.Fatalf("first delivery rejected: %v", err)
+			}
+			if tt.forget {
+				verifier.Forget(tt.first.Get(HeaderDeliveryID))
+			}
+			err := verifier.verify(tt.second, testBody, testNow.Add(tt.later))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("second delivery error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	header := signedHeader("d1", testNow)
+	if got := header.Get(HeaderTimestamp); got != strconv.FormatInt(testNow.Unix(), 10) {
+		t.Errorf("X-Timestamp = %q", got)
+	}
+	if got := header.Get(HeaderDeliveryID); got != "d1" {
+		t.Errorf("X-Delivery-ID = %q", got)
+	}
+	if got, want := header.Get(HeaderSignature), Sign(testSecret, header.Get(HeaderTimestamp), "d1", testBody); got != want {
+		t.Errorf("X-Signature = %q, want %q", got, want)
+	}
+}